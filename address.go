@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// publicKeyForms holds the encodings of a secp256k1 public key.
+type publicKeyForms struct {
+	// compressed is the 33-byte SEC1 encoding, uncompressed the 65-byte one
+	// and xOnly the 32-byte BIP-340 x coordinate.
+	compressed, uncompressed, xOnly []byte
+}
+
+func encodePublicKey(public curve.Point) (*publicKeyForms, error) {
+	p, ok := public.(*curve.Secp256k1Point)
+	if !ok || p.IsIdentity() {
+		return nil, errors.New("public key is not a secp256k1 point")
+	}
+	compressed, err := p.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	x, y := p.XBytes(), p.YBytes()
+	uncompressed := append(append([]byte{4}, x...), y...)
+	return &publicKeyForms{compressed: compressed, uncompressed: uncompressed, xOnly: x}, nil
+}
+
+// ethereumAddress returns the address of a public key, which prints in its
+// EIP-55 checksummed form.
+func ethereumAddress(public curve.Point) (common.Address, error) {
+	forms, err := encodePublicKey(public)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(crypto.Keccak256(forms.uncompressed[1:])[12:]), nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+	"github.com/capsule-org/multi-party-sig/protocols/doerner"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// backupKeyLabel is the heading of the backup key section in CapsuleBackupShare.pdf.
+const backupKeyLabel = "Capsule Backup Key"
+
+var (
+	backupKeyLabelPattern = regexp.MustCompile(`(?i)capsule\s*backup\s*key\s*:?`)
+	base64LinePattern     = regexp.MustCompile(`^[A-Za-z0-9+/]+={0,2}$`)
+	// keyLinePattern matches a line of the key that may have characters
+	// mangled by the pdf: a single word with base64 characters in it.
+	keyLinePattern = regexp.MustCompile(`^\S*[A-Za-z0-9+/]\S*$`)
+)
+
+// ligatures maps the typographic ligatures a pdf may use for letter pairs back
+// to the letters they stand for.
+var ligatures = strings.NewReplacer(
+	"ﬀ", "ff",
+	"ﬁ", "fi",
+	"ﬂ", "fl",
+	"ﬃ", "ffi",
+	"ﬄ", "ffl",
+)
+
+// backupKeyFromPDF extracts the exact receiver config from the "Capsule
+// Backup Key" section of CapsuleBackupShare.pdf.
+//
+// The section is followed by other text, so the key is the longest run of
+// base64 lines after the heading that decodes to a DKLS config. If none
+// does and the section has characters that aren't base64, the whole section
+// is returned as a damaged key, to be repaired against the user share.
+func backupKeyFromPDF(data []byte) (string, error) {
+	text, err := extractPDFText(data)
+	if err != nil {
+		return "", fmt.Errorf("reading backup kit pdf: %w", err)
+	}
+
+	sections := backupKeySections(ligatures.Replace(text))
+	if len(sections) == 0 {
+		return "", fmt.Errorf("no %q section found in the pdf", backupKeyLabel)
+	}
+
+	var firstErr error
+	for _, lines := range sections {
+		for n := len(lines); n > 0; n-- {
+			key := strings.Join(lines[:n], "")
+			err := checkBackupConfig(key)
+			if err == nil {
+				return key, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	for _, lines := range sections {
+		for _, line := range lines {
+			if !base64LinePattern.MatchString(line) {
+				return strings.Join(lines, ""), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("the %q section of the pdf doesn't hold a valid backup key: %w", backupKeyLabel, firstErr)
+}
+
+// backupKeySections returns, for every backup key heading in text, the run of
+// key lines that follows it, up to a blank line or the next heading. Lines
+// with characters the pdf mangled are kept, so the key can be repaired.
+func backupKeySections(text string) [][]string {
+	var sections [][]string
+	for _, loc := range backupKeyLabelPattern.FindAllStringIndex(text, -1) {
+		lines := strings.Split(text[loc[1]:], "\n")
+
+		// the rest of the heading's own line only counts if it's part of the key
+		if first := strings.TrimSpace(lines[0]); first != "" && !keyLinePattern.MatchString(first) {
+			lines = lines[1:]
+		}
+
+		var section []string
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				if len(section) > 0 {
+					break
+				}
+				continue
+			}
+			if !keyLinePattern.MatchString(line) {
+				break
+			}
+			section = append(section, line)
+		}
+		if len(section) > 0 {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// checkBackupConfig checks that key decodes to a config of either role. Most
+// backup kits hold the receiver config, but wallets where the user holds the
+// receiver role back up the sender.
+func checkBackupConfig(key string) error {
+	_, err := decodeReceiverConfig(key)
+	if err != nil {
+		if _, senderErr := decodeSenderConfig(key); senderErr == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// decodeReceiverConfig decodes a base64 encoded doerner.ConfigReceiver, as
+// stored in the backup kit.
+func decodeReceiverConfig(receiverConfig string) (*doerner.ConfigReceiver, error) {
+	raw, err := base64.StdEncoding.DecodeString(receiverConfig)
+	if err != nil {
+		return nil, err
+	}
+	config := doerner.EmptyConfigReceiver(curve.Secp256k1{})
+	if err := cbor.Unmarshal(raw, config); err != nil {
+		return nil, err
+	}
+	if config.SecretShare.IsZero() {
+		return nil, errors.New("receiver config has no secret share")
+	}
+	return config, nil
+}
+
+// decodeSenderConfig decodes a base64 encoded doerner.ConfigSender, as stored
+// in the backup kit of a wallet where the user holds the receiver role.
+func decodeSenderConfig(senderConfig string) (*doerner.ConfigSender, error) {
+	raw, err := base64.StdEncoding.DecodeString(senderConfig)
+	if err != nil {
+		return nil, err
+	}
+	config := doerner.EmptyConfigSender(curve.Secp256k1{})
+	if err := cbor.Unmarshal(raw, config); err != nil {
+		return nil, err
+	}
+	if config.SecretShare.IsZero() {
+		return nil, errors.New("sender config has no secret share")
+	}
+	return config, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildPDF assembles a pdf from the bodies of objects 1, 2, ... with object
+// 1 as the catalog. There's no xref table, the reader doesn't need one.
+func buildPDF(objects ...string) []byte {
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return []byte(b.String())
+}
+
+// pdfStreamObject is the body of a stream object with data as its contents.
+func pdfStreamObject(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// onePagePDF is a pdf with a single page showing contents in font F1, whose
+// dictionary is font.
+func onePagePDF(contents string, font string, extra ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		pdfStreamObject("", []byte(contents)),
+		font,
+	}
+	return buildPDF(append(objects, extra...)...)
+}
+
+// showLines is a content stream showing each line with Tj on a line of
+// its own.
+func showLines(lines ...string) string {
+	var b strings.Builder
+	b.WriteString("BT /F1 10 Tf 50 700 Td 12 TL\n")
+	for _, line := range lines {
+		fmt.Fprintf(&b, "(%s) Tj T*\n", line)
+	}
+	b.WriteString("ET")
+	return b.String()
+}
+
+func TestBackupKeySections(t *testing.T) {
+	tests := []struct {
+		name, text string
+		want       [][]string
+	}{
+		{"plain", "Capsule Backup Key\nAAAA\nBBBB\nRecovery Instructions\nCCCC\n", [][]string{{"AAAA", "BBBB"}}},
+		{"key on the heading line", "Capsule Backup Key: AAAA\nBBBB\n", [][]string{{"AAAA", "BBBB"}}},
+		{"lookalike kept", "Capsule Backup Key\nAAAA\nBАBB\nCCCC\nMore text here\n", [][]string{{"AAAA", "BАBB", "CCCC"}}},
+		{"ends at a blank line", "Capsule Backup Key\n\nAAAA\n\nBBBB\n", [][]string{{"AAAA"}}},
+		{"no key", "Capsule Backup Key\nKeep this document safe\n", nil},
+	}
+	for _, tt := range tests {
+		if got := backupKeySections(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBackupKeyFromPDFRepairsLookalike(t *testing.T) {
+	w := newTestWallet(t)
+
+	// the font maps code 0x80 to a Cyrillic A, the way a pdf writer may
+	// substitute a glyph
+	look := strings.IndexByte(w.backup, 'A')
+	if look < 0 {
+		t.Skip("the backup key has no A")
+	}
+	damaged := w.backup[:look] + "\x80" + w.backup[look+1:]
+	var lines []string
+	for len(damaged) > 0 {
+		n := min(70, len(damaged))
+		lines = append(lines, damaged[:n])
+		damaged = damaged[n:]
+	}
+	cmap := "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"1 begincodespacerange <00> <ff> endcodespacerange\n" +
+		"1 beginbfrange <20> <7e> <0020> endbfrange\n" +
+		"1 beginbfchar <80> <0410> endbfchar\n" +
+		"endcmap end end"
+	pdf := onePagePDF(showLines(append([]string{"Capsule Backup Key"}, append(lines, "Keep this document safe")...)...),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /ToUnicode 6 0 R >>",
+		pdfStreamObject("", []byte(cmap)))
+
+	share, err := classifyShare(pdf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(share.backupKey, "А") {
+		t.Fatalf("the lookalike didn't reach the backup key: %q", share.backupKey)
+	}
+	repaired, fixes, err := repairBackupKey(share.backupKey, w.user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired != w.backup || len(fixes) != 1 {
+		t.Fatalf("repaired to a different key with fixes %v", fixes)
+	}
+}
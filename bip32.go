@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+	"github.com/mr-tron/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// hardenedOffset is the first index of a hardened child.
+const hardenedOffset = 1 << 31
+
+// Version bytes of serialized mainnet extended keys.
+const (
+	xprvVersion = 0x0488ade4
+	xpubVersion = 0x0488b21e
+)
+
+// extendedKey is a BIP32 extended key. private is nil for an extended
+// public key.
+type extendedKey struct {
+	private           curve.Scalar
+	public            curve.Point
+	chainCode         []byte
+	depth             uint8
+	parentFingerprint []byte
+	childNumber       uint32
+}
+
+// newRootKey makes the depth 0 extended key of a wallet from its key and
+// the chain key its shares record. private may be nil.
+func newRootKey(private curve.Scalar, public curve.Point, chainKey []byte) (*extendedKey, error) {
+	if len(chainKey) != chainKeyBytes {
+		return nil, fmt.Errorf("the shares record a chain key of %d bytes instead of %d, keys can't be derived from them", len(chainKey), chainKeyBytes)
+	}
+	return &extendedKey{
+		private:           private,
+		public:            public,
+		chainCode:         chainKey,
+		parentFingerprint: make([]byte, 4),
+	}, nil
+}
+
+// child derives the child key at index i. Hardened children can only be
+// derived from a private key. Non-hardened steps are the math of the DKLS
+// configs' DeriveBIP32, whose bip32.DeriveScalar is internal to its module.
+func (k *extendedKey) child(i uint32) (*extendedKey, error) {
+	child, _, err := k.childWithTweak(i)
+	return child, err
+}
+
+// childWithTweak derives the child key at index i, and also returns the
+// tweak that was added to the parent's key to get it.
+func (k *extendedKey) childWithTweak(i uint32) (*extendedKey, curve.Scalar, error) {
+	if k.depth == 255 {
+		return nil, nil, errors.New("the key is at the deepest depth BIP32 allows")
+	}
+	forms, err := encodePublicKey(k.public)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := hmac.New(sha512.New, k.chainCode)
+	if i >= hardenedOffset {
+		if k.private == nil {
+			return nil, nil, fmt.Errorf("hardened step %s can't be derived from a public key", formatPathStep(i))
+		}
+		secret, err := k.private.MarshalBinary()
+		if err != nil {
+			return nil, nil, err
+		}
+		h.Write([]byte{0})
+		h.Write(secret)
+	} else {
+		h.Write(forms.compressed)
+	}
+	h.Write(binary.BigEndian.AppendUint32(nil, i))
+	sum := h.Sum(nil)
+
+	// BIP32 skips the index in the unlikely case the tweak is out of range
+	tweak := curve.Secp256k1{}.NewScalar()
+	if err := tweak.UnmarshalBinary(sum[:32]); err != nil {
+		return nil, nil, fmt.Errorf("step %s gives an invalid key, BIP32 wallets skip it", formatPathStep(i))
+	}
+	child := &extendedKey{
+		chainCode:         sum[32:],
+		depth:             k.depth + 1,
+		parentFingerprint: hash160(forms.compressed)[:4],
+		childNumber:       i,
+	}
+	if k.private != nil {
+		child.private = curve.Secp256k1{}.NewScalar().Set(tweak).Add(k.private)
+		child.public = child.private.ActOnBase()
+	} else {
+		child.public = tweak.ActOnBase().Add(k.public)
+	}
+	if child.public.IsIdentity() {
+		return nil, nil, fmt.Errorf("step %s gives an invalid key, BIP32 wallets skip it", formatPathStep(i))
+	}
+	return child, tweak, nil
+}
+
+// derive derives the key at the end of a path of child indices.
+func (k *extendedKey) derive(path []uint32) (*extendedKey, error) {
+	for _, i := range path {
+		var err error
+		if k, err = k.child(i); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// neuter returns the extended public key of k.
+func (k *extendedKey) neuter() *extendedKey {
+	public := *k
+	public.private = nil
+	return &public
+}
+
+// String serializes the key as an xprv, or as an xpub if it's public.
+func (k *extendedKey) String() string {
+	version, key := uint32(xpubVersion), []byte(nil)
+	if k.private != nil {
+		secret, _ := k.private.MarshalBinary()
+		version, key = xprvVersion, append([]byte{0}, secret...)
+	} else {
+		forms, err := encodePublicKey(k.public)
+		if err != nil {
+			return "invalid key"
+		}
+		key = forms.compressed
+	}
+
+	data := binary.BigEndian.AppendUint32(nil, version)
+	data = append(data, k.depth)
+	data = append(data, k.parentFingerprint...)
+	data = binary.BigEndian.AppendUint32(data, k.childNumber)
+	data = append(data, k.chainCode...)
+	data = append(data, key...)
+	return base58CheckEncode(data)
+}
+
+// base58CheckEncode encodes data in base58 with a double SHA-256 checksum.
+func base58CheckEncode(data []byte) string {
+	first := sha256.Sum256(data)
+	checksum := sha256.Sum256(first[:])
+	return base58.Encode(append(data[:len(data):len(data)], checksum[:4]...))
+}
+
+// hash160 is RIPEMD-160 of SHA-256, the hash keys are identified by in
+// BIP32 and Bitcoin.
+func hash160(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
+
+// derivationPath is a BIP32 path such as m/44'/60'/0'/0/i. Its last step
+// may be the placeholder i, which stands for a range of indices.
+type derivationPath struct {
+	steps []uint32
+	// indexed is set when the last step is i, hardenedIndex when it's i'.
+	indexed, hardenedIndex bool
+}
+
+// parseDerivationPath parses a path starting at m, with hardened steps
+// marked by ' or h.
+func parseDerivationPath(s string) (*derivationPath, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("path %q doesn't start with m", s)
+	}
+	p := &derivationPath{}
+	for n, part := range parts[1:] {
+		step, hardened := strings.CutSuffix(part, "'")
+		if !hardened {
+			step, hardened = strings.CutSuffix(strings.ToLower(part), "h")
+		}
+		if step == "i" {
+			if n != len(parts)-2 {
+				return nil, fmt.Errorf("path %q has i before its last step", s)
+			}
+			p.indexed, p.hardenedIndex = true, hardened
+			break
+		}
+		i, err := strconv.ParseUint(step, 10, 32)
+		if err != nil || i >= hardenedOffset || step != strconv.FormatUint(i, 10) {
+			return nil, fmt.Errorf("path %q has an invalid step %q", s, part)
+		}
+		if hardened {
+			i += hardenedOffset
+		}
+		p.steps = append(p.steps, uint32(i))
+	}
+	return p, nil
+}
+
+// expand returns the paths for count indices from start. A path without
+// the placeholder expands to itself.
+func (p *derivationPath) expand(start, count uint32) ([][]uint32, error) {
+	if !p.indexed {
+		return [][]uint32{p.steps}, nil
+	}
+	if count == 0 {
+		return nil, errors.New("no indices to derive")
+	}
+	if uint64(start)+uint64(count) > hardenedOffset {
+		return nil, fmt.Errorf("indices %d to %d are out of range", start, uint64(start)+uint64(count)-1)
+	}
+	paths := make([][]uint32, count)
+	for n := range paths {
+		i := start + uint32(n)
+		if p.hardenedIndex {
+			i += hardenedOffset
+		}
+		paths[n] = append(p.steps[:len(p.steps):len(p.steps)], i)
+	}
+	return paths, nil
+}
+
+func formatPath(path []uint32) string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, i := range path {
+		b.WriteString("/" + formatPathStep(i))
+	}
+	return b.String()
+}
+
+func formatPathStep(i uint32) string {
+	if i >= hardenedOffset {
+		return strconv.FormatUint(uint64(i-hardenedOffset), 10) + "'"
+	}
+	return strconv.FormatUint(uint64(i), 10)
+}
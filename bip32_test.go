@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+)
+
+func TestHash160(t *testing.T) {
+	// the key hash of the compressed public key of private key 1
+	public, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	if got := hex.EncodeToString(hash160(public)); got != "751e76e8199196d454941c45d1b3a323f1433bd6" {
+		t.Errorf("got %s", got)
+	}
+}
+
+// seedRootKey is the BIP32 master key of a hex seed.
+func seedRootKey(t *testing.T, seedHex string) *extendedKey {
+	t.Helper()
+	seed, _ := hex.DecodeString(seedHex)
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	sk := curve.Secp256k1{}.NewScalar()
+	if err := sk.UnmarshalBinary(sum[:32]); err != nil {
+		t.Fatal(err)
+	}
+	root, err := newRootKey(sk, sk.ActOnBase(), sum[32:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// TestExtendedKeyVector1 checks derivation and serialization against test
+// vector 1 of BIP32.
+func TestExtendedKeyVector1(t *testing.T) {
+	root := seedRootKey(t, "000102030405060708090a0b0c0d0e0f")
+
+	vectors := []struct {
+		path       string
+		xprv, xpub string
+	}{
+		{"m",
+			"xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+			"xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"},
+		{"m/0H",
+			"xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7",
+			"xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"},
+		{"m/0H/1",
+			"xprv9wTYmMFdV23N2TdNG573QoEsfRrWKQgWeibmLntzniatZvR9BmLnvSxqu53Kw1UmYPxLgboyZQaXwTCg8MSY3H2EU4pWcQDnRnrVA1xe8fs",
+			"xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"},
+	}
+	for _, v := range vectors {
+		path, err := parseDerivationPath(v.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := root.derive(path.steps)
+		if err != nil {
+			t.Fatalf("%s: %v", v.path, err)
+		}
+		if got := key.String(); got != v.xprv {
+			t.Errorf("%s: xprv %s, want %s", v.path, got, v.xprv)
+		}
+		if got := key.neuter().String(); got != v.xpub {
+			t.Errorf("%s: xpub %s, want %s", v.path, got, v.xpub)
+		}
+	}
+
+	// the non-hardened last step can be derived from the parent's xpub alone
+	parent, err := root.child(hardenedOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := parent.neuter().child(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := public.String(); got != vectors[2].xpub {
+		t.Errorf("m/0H/1 from the xpub of m/0H: %s, want %s", got, vectors[2].xpub)
+	}
+	if _, err := root.neuter().child(hardenedOffset); err == nil || !strings.Contains(err.Error(), "hardened") {
+		t.Errorf("derived a hardened child from a public key: %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+)
+
+// bitcoinNetwork holds the prefixes keys and addresses are encoded with on
+// one Bitcoin network.
+type bitcoinNetwork struct {
+	name string
+	// wif, p2pkh and p2sh are base58check version bytes, hrp the bech32
+	// human-readable part.
+	wif, p2pkh, p2sh byte
+	hrp              string
+}
+
+var bitcoinNetworks = []bitcoinNetwork{
+	{name: "mainnet", wif: 0x80, p2pkh: 0x00, p2sh: 0x05, hrp: "bc"},
+	{name: "testnet", wif: 0xef, p2pkh: 0x6f, p2sh: 0xc4, hrp: "tb"},
+	{name: "signet", wif: 0xef, p2pkh: 0x6f, p2sh: 0xc4, hrp: "tb"},
+	{name: "regtest", wif: 0xef, p2pkh: 0x6f, p2sh: 0xc4, hrp: "bcrt"},
+}
+
+func findBitcoinNetwork(name string) *bitcoinNetwork {
+	for i := range bitcoinNetworks {
+		if bitcoinNetworks[i].name == name {
+			return &bitcoinNetworks[i]
+		}
+	}
+	return nil
+}
+
+// printBitcoinKeys prints a private key in WIF, the standard addresses of
+// its public key, and the output descriptors Bitcoin Core and Sparrow
+// import them with.
+func printBitcoinKeys(w io.Writer, sk curve.Scalar, net *bitcoinNetwork) error {
+	secret, err := sk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	forms, err := encodePublicKey(sk.ActOnBase())
+	if err != nil {
+		return err
+	}
+	outputKey, err := taprootOutputKey(sk.ActOnBase())
+	if err != nil {
+		return err
+	}
+
+	wif := base58CheckEncode(append(append([]byte{net.wif}, secret...), 1))
+	wifUncompressed := base58CheckEncode(append([]byte{net.wif}, secret...))
+	keyHash := hash160(forms.compressed)
+	// P2SH-P2WPKH pays to the hash of the P2WPKH script
+	redeemScript := append([]byte{0x00, 0x14}, keyHash...)
+
+	fmt.Fprintf(w, "network:                     %s\n", net.name)
+	fmt.Fprintln(w, "private key WIF (compressed):")
+	fmt.Fprintln(w, wif)
+	fmt.Fprintln(w, "private key WIF (uncompressed, legacy P2PKH only):")
+	fmt.Fprintln(w, wifUncompressed)
+
+	fmt.Fprintln(w, "\naddresses:")
+	fmt.Fprintf(w, "  P2PKH:                     %s\n", base58CheckEncode(append([]byte{net.p2pkh}, keyHash...)))
+	fmt.Fprintf(w, "  P2PKH (uncompressed key):  %s\n", base58CheckEncode(append([]byte{net.p2pkh}, hash160(forms.uncompressed)...)))
+	fmt.Fprintf(w, "  P2SH-P2WPKH:               %s\n", base58CheckEncode(append([]byte{net.p2sh}, hash160(redeemScript)...)))
+	fmt.Fprintf(w, "  P2WPKH:                    %s\n", segwitAddress(net.hrp, 0, keyHash))
+	fmt.Fprintf(w, "  P2TR:                      %s\n", segwitAddress(net.hrp, 1, outputKey))
+
+	pub := fmt.Sprintf("%x", forms.compressed)
+	xOnly := fmt.Sprintf("%x", forms.xOnly)
+	fmt.Fprintln(w, "\ndescriptors with the private key:")
+	for _, desc := range []string{"pkh(" + wif + ")", "sh(wpkh(" + wif + "))", "wpkh(" + wif + ")", "tr(" + wif + ")"} {
+		fmt.Fprintf(w, "  %s\n", withDescriptorChecksum(desc))
+	}
+	fmt.Fprintln(w, "watch-only descriptors:")
+	for _, desc := range []string{"pkh(" + pub + ")", "sh(wpkh(" + pub + "))", "wpkh(" + pub + ")", "tr(" + xOnly + ")"} {
+		fmt.Fprintf(w, "  %s\n", withDescriptorChecksum(desc))
+	}
+	return nil
+}
+
+// taprootOutputKey tweaks a public key as the internal key of a taproot
+// output without a script tree, as BIP-86 does, and returns the x-only
+// output key.
+func taprootOutputKey(public curve.Point) ([]byte, error) {
+	p, ok := public.(*curve.Secp256k1Point)
+	if !ok || p.IsIdentity() {
+		return nil, errors.New("public key is not a secp256k1 point")
+	}
+	// the internal key is the point with an even y of the same x
+	var internal curve.Point = p
+	if !p.HasEvenY() {
+		internal = p.Negate()
+	}
+	tweak := curve.Secp256k1{}.NewScalar()
+	if err := tweak.UnmarshalBinary(taggedHash("TapTweak", p.XBytes())); err != nil {
+		return nil, errors.New("the taproot tweak is out of range")
+	}
+	output := internal.Add(tweak.ActOnBase()).(*curve.Secp256k1Point)
+	if output.IsIdentity() {
+		return nil, errors.New("the taproot output key is the point at infinity")
+	}
+	return output.XBytes(), nil
+}
+
+// taggedHash is the BIP-340 tagged hash.
+func taggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// Checksum constants of bech32 (BIP-173), used for version 0 witness
+// programs, and of bech32m (BIP-350), used for later versions.
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range generator {
+			if (top>>i)&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+// segwitAddress encodes a witness program as a bech32 address for version
+// 0, and as a bech32m address for later versions.
+func segwitAddress(hrp string, version byte, program []byte) string {
+	data := append([]byte{version}, convertBits(program, 8, 5)...)
+	constant := uint32(bech32Const)
+	if version > 0 {
+		constant = bech32mConst
+	}
+
+	var values []byte
+	for _, c := range []byte(hrp) {
+		values = append(values, c>>5)
+	}
+	values = append(values, 0)
+	for _, c := range []byte(hrp) {
+		values = append(values, c&31)
+	}
+	values = append(values, data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	checksum := bech32Polymod(values) ^ constant
+
+	var b strings.Builder
+	b.WriteString(hrp + "1")
+	for _, d := range data {
+		b.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[(checksum>>(5*(5-i)))&31])
+	}
+	return b.String()
+}
+
+// convertBits regroups bits, padding the last group with zeros.
+func convertBits(data []byte, from, to uint) []byte {
+	var out []byte
+	acc, bits := uint32(0), uint(0)
+	for _, b := range data {
+		acc = acc<<from | uint32(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits)&(1<<to-1))
+		}
+	}
+	if bits > 0 {
+		out = append(out, byte(acc<<(to-bits))&(1<<to-1))
+	}
+	return out
+}
+
+// descriptorCharset orders the characters of output descriptors for their
+// checksum, as BIP-380 defines.
+const descriptorCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+	"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+	"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+func descriptorPolymod(c uint64, value int) uint64 {
+	generator := [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+	top := c >> 35
+	c = (c&0x7ffffffff)<<5 ^ uint64(value)
+	for i, g := range generator {
+		if (top>>i)&1 == 1 {
+			c ^= g
+		}
+	}
+	return c
+}
+
+// withDescriptorChecksum appends the BIP-380 checksum to a descriptor. The
+// descriptors built here only use characters the checksum covers.
+func withDescriptorChecksum(desc string) string {
+	c := uint64(1)
+	class, count := 0, 0
+	for _, ch := range desc {
+		pos := strings.IndexRune(descriptorCharset, ch)
+		c = descriptorPolymod(c, pos&31)
+		class = class*3 + pos>>5
+		if count++; count == 3 {
+			c = descriptorPolymod(c, class)
+			class, count = 0, 0
+		}
+	}
+	if count > 0 {
+		c = descriptorPolymod(c, class)
+	}
+	for i := 0; i < 8; i++ {
+		c = descriptorPolymod(c, 0)
+	}
+	c ^= 1
+
+	checksum := make([]byte, 8)
+	for i := range checksum {
+		checksum[i] = bech32Charset[(c>>(5*(7-i)))&31]
+	}
+	return desc + "#" + string(checksum)
+}
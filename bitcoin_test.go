@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+)
+
+// TestSegwitAddress checks the valid addresses of BIP-173, for version 0,
+// and of BIP-350, for later versions.
+func TestSegwitAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		version byte
+		program string
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", 0, "751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", 0, "1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy", 0, "000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", 1, "751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"BC1SW50QGDZ25J", 16, "751e"},
+		{"bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", 2, "751e76e8199196d454941c45d1b3a323"},
+		{"tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", 1, "000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", 1, "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	}
+	for _, tt := range tests {
+		want := strings.ToLower(tt.address)
+		program, _ := hex.DecodeString(tt.program)
+		if got := segwitAddress(want[:strings.LastIndexByte(want, '1')], tt.version, program); got != want {
+			t.Errorf("version %d program %s: got %s, want %s", tt.version, tt.program, got, want)
+		}
+	}
+}
+
+// TestTaprootOutputKey checks the key at m/86'/0'/0'/0/0 of the BIP-86 test
+// vector, whose seed is that of the mnemonic "abandon ... about".
+func TestTaprootOutputKey(t *testing.T) {
+	root := seedRootKey(t, "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4")
+	path, err := parseDerivationPath("m/86'/0'/0'/0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := root.derive(path.steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forms, err := encodePublicKey(key.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(forms.xOnly); got != "cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115" {
+		t.Errorf("internal key %s", got)
+	}
+	output, err := taprootOutputKey(key.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(output); got != "a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c" {
+		t.Errorf("output key %s", got)
+	}
+	if got := segwitAddress("bc", 1, output); got != "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr" {
+		t.Errorf("address %s", got)
+	}
+}
+
+// TestDescriptorChecksum checks the example of BIP-380 and descriptors from
+// the Bitcoin Core documentation.
+func TestDescriptorChecksum(t *testing.T) {
+	for _, want := range []string{
+		"raw(deadbeef)#89f8spxm",
+		"pk(0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798)#gn28ywm7",
+		"pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)#8fhd9pwu",
+		"wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)#8zl0zxma",
+		"sh(wpkh(03fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556))#qkrrc7je",
+	} {
+		if got := withDescriptorChecksum(want[:strings.IndexByte(want, '#')]); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+// TestPrintBitcoinKeysWIF checks the WIF of private key 1, compressed and
+// uncompressed, on mainnet and testnet.
+func TestPrintBitcoinKeysWIF(t *testing.T) {
+	sk := curve.Secp256k1{}.NewScalar()
+	one := make([]byte, 32)
+	one[31] = 1
+	if err := sk.UnmarshalBinary(one); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		network, compressed, uncompressed string
+	}{
+		{"mainnet", "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn", "5HpHagT65TZzG1PH3CSu63k8DbpvD8s5ip4nEB3kEsreAnchuDf"},
+		{"testnet", "cMahea7zqjxrtgAbB7LSGbcQUr1uX1ojuat9jZodMN87JcbXMTcA", "91avARGdfge8E4tZfYLoxeJ5sGBdNJQH4kvjJoQFacbgwmaKkrx"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := printBitcoinKeys(&out, sk, findBitcoinNetwork(tt.network)); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(out.String(), "\n")
+		if lines[2] != tt.compressed || lines[4] != tt.uncompressed {
+			t.Errorf("%s: got WIFs %s and %s", tt.network, lines[2], lines[4])
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxCallDepth bounds how deep multicalls nested in multicalls are decoded.
+const maxCallDepth = 4
+
+var maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// abiFunction is an entry of the offline signature table.
+type abiFunction struct {
+	standard  string
+	signature string
+	names     []string
+}
+
+// knownFunctions is the offline signature table calldata is decoded with.
+var knownFunctions = []abiFunction{
+	{"ERC-20", "transfer(address,uint256)", []string{"to", "amount"}},
+	{"ERC-20", "approve(address,uint256)", []string{"spender", "amount"}},
+	{"ERC-20/ERC-721", "transferFrom(address,address,uint256)", []string{"from", "to", "amount or token ID"}},
+	{"ERC-721", "safeTransferFrom(address,address,uint256)", []string{"from", "to", "token ID"}},
+	{"ERC-721", "safeTransferFrom(address,address,uint256,bytes)", []string{"from", "to", "token ID", "data"}},
+	{"ERC-721", "setApprovalForAll(address,bool)", []string{"operator", "approved"}},
+	{"multicall", "multicall(bytes[])", []string{"calls"}},
+	{"multicall", "multicall(uint256,bytes[])", []string{"deadline", "calls"}},
+}
+
+func (f *abiFunction) selector() []byte {
+	return crypto.Keccak256([]byte(f.signature))[:4]
+}
+
+func (f *abiFunction) argTypes() []string {
+	args := f.signature[strings.IndexByte(f.signature, '(')+1 : len(f.signature)-1]
+	return strings.Split(args, ",")
+}
+
+func lookupFunction(selector []byte) *abiFunction {
+	for i := range knownFunctions {
+		if string(knownFunctions[i].selector()) == string(selector) {
+			return &knownFunctions[i]
+		}
+	}
+	return nil
+}
+
+// printCall decodes calldata with the signature table and prints the call
+// and its arguments. Calls made by a multicall are printed below it.
+func printCall(w io.Writer, indent string, data []byte, depth int) {
+	if len(data) < 4 {
+		fmt.Fprintf(w, "%sfunction:     none, %d bytes of data that aren't a call\n", indent, len(data))
+		return
+	}
+	f := lookupFunction(data[:4])
+	if f == nil {
+		fmt.Fprintf(w, "%sfunction:     unknown selector 0x%x, the call can't be decoded offline\n", indent, data[:4])
+		return
+	}
+	fmt.Fprintf(w, "%sfunction:     %s (%s)\n", indent, f.signature, f.standard)
+	args, err := decodeABI(f.argTypes(), data[4:])
+	if err != nil {
+		fmt.Fprintf(w, "%s  the arguments don't decode: %v\n", indent, err)
+		return
+	}
+	for i, arg := range args {
+		name := f.names[i]
+		switch v := arg.(type) {
+		case common.Address:
+			fmt.Fprintf(w, "%s  %-12s %s\n", indent, name+":", v.Hex())
+		case *big.Int:
+			if v.Cmp(maxUint256) == 0 {
+				fmt.Fprintf(w, "%s  %-12s %s, the maximum, which is unlimited for an approval\n", indent, name+":", v)
+			} else {
+				fmt.Fprintf(w, "%s  %-12s %s\n", indent, name+":", v)
+			}
+		case bool:
+			fmt.Fprintf(w, "%s  %-12s %t\n", indent, name+":", v)
+		case []byte:
+			fmt.Fprintf(w, "%s  %-12s 0x%x\n", indent, name+":", v)
+		case [][]byte:
+			fmt.Fprintf(w, "%s  %-12s %d\n", indent, name+":", len(v))
+			for j, call := range v {
+				fmt.Fprintf(w, "%s  call %d:\n", indent, j)
+				if depth >= maxCallDepth {
+					fmt.Fprintf(w, "%s    not decoded, the calls are nested too deep\n", indent)
+					continue
+				}
+				printCall(w, indent+"    ", call, depth+1)
+			}
+		}
+	}
+}
+
+// decodeABI decodes ABI encoded arguments of the types the signature table
+// uses: address, uint256, bool, bytes and bytes[].
+func decodeABI(types []string, data []byte) ([]any, error) {
+	args := make([]any, len(types))
+	for i, typ := range types {
+		head, err := abiWord(data, i*32)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "address":
+			if new(big.Int).SetBytes(head[:12]).Sign() != 0 {
+				return nil, fmt.Errorf("argument %d is not an address", i)
+			}
+			args[i] = common.BytesToAddress(head[12:])
+		case "uint256":
+			args[i] = new(big.Int).SetBytes(head)
+		case "bool":
+			n := new(big.Int).SetBytes(head)
+			if n.Cmp(big.NewInt(1)) > 0 {
+				return nil, fmt.Errorf("argument %d is not a bool", i)
+			}
+			args[i] = n.Sign() == 1
+		case "bytes":
+			args[i], err = abiBytes(data, head)
+		case "bytes[]":
+			args[i], err = abiBytesArray(data, head)
+		default:
+			return nil, fmt.Errorf("type %s can't be decoded", typ)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+	}
+	return args, nil
+}
+
+func abiWord(data []byte, offset int) ([]byte, error) {
+	if offset < 0 || offset+32 > len(data) {
+		return nil, errors.New("the calldata is too short")
+	}
+	return data[offset : offset+32], nil
+}
+
+// abiOffset reads a word used as an offset or length, which has to point
+// inside the data.
+func abiOffset(data, word []byte) (int, error) {
+	n := new(big.Int).SetBytes(word)
+	if !n.IsInt64() || n.Int64() > int64(len(data)) {
+		return 0, errors.New("an offset points outside the calldata")
+	}
+	return int(n.Int64()), nil
+}
+
+func abiBytes(data, head []byte) ([]byte, error) {
+	offset, err := abiOffset(data, head)
+	if err != nil {
+		return nil, err
+	}
+	lengthWord, err := abiWord(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	length, err := abiOffset(data, lengthWord)
+	if err != nil {
+		return nil, err
+	}
+	start := offset + 32
+	if start+length > len(data) {
+		return nil, errors.New("the bytes run past the end of the calldata")
+	}
+	return data[start : start+length], nil
+}
+
+func abiBytesArray(data, head []byte) ([][]byte, error) {
+	offset, err := abiOffset(data, head)
+	if err != nil {
+		return nil, err
+	}
+	countWord, err := abiWord(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	count, err := abiOffset(data, countWord)
+	if err != nil {
+		return nil, err
+	}
+	// the items' offsets count from the start of the array's contents
+	items := data[offset+32:]
+	out := make([][]byte, count)
+	for i := range out {
+		itemHead, err := abiWord(items, i*32)
+		if err != nil {
+			return nil, err
+		}
+		if out[i], err = abiBytes(items, itemHead); err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// cborReader reads just enough cbor to walk serialized DKLS configs while
+// keeping track of byte offsets, which the cbor package doesn't expose.
+type cborReader struct {
+	data []byte
+	pos  int
+}
+
+// Major types and simple values used by serialized configs.
+const (
+	cborUint   = 0
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborSimple = 7
+
+	cborNull = 0xf6
+)
+
+var errCBORShort = errors.New("unexpected end of data")
+
+func cborMajorName(major byte) string {
+	switch major {
+	case 0:
+		return "an unsigned integer"
+	case 1:
+		return "a negative integer"
+	case cborBytes:
+		return "a byte string"
+	case cborText:
+		return "a text string"
+	case cborArray:
+		return "an array"
+	case cborMap:
+		return "a map"
+	case 6:
+		return "a tag"
+	}
+	return "a simple value"
+}
+
+// head reads an item header, returning its major type and argument.
+func (r *cborReader) head() (byte, uint64, error) {
+	if r.pos >= len(r.data) {
+		return 0, 0, errCBORShort
+	}
+	b := r.data[r.pos]
+	major, info := b>>5, b&0x1f
+	r.pos++
+
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		if r.pos+size > len(r.data) {
+			r.pos = len(r.data)
+			return 0, 0, errCBORShort
+		}
+		var n uint64
+		for _, c := range r.data[r.pos : r.pos+size] {
+			n = n<<8 | uint64(c)
+		}
+		r.pos += size
+		return major, n, nil
+	case info == 31 && major != cborSimple:
+		return major, 0, errors.New("indefinite length items are not used by configs")
+	}
+	return major, 0, fmt.Errorf("invalid header byte 0x%02x", b)
+}
+
+// bytes reads a byte string.
+func (r *cborReader) bytes() ([]byte, error) {
+	return r.stringOf(cborBytes)
+}
+
+// text reads a text string.
+func (r *cborReader) text() (string, error) {
+	b, err := r.stringOf(cborText)
+	return string(b), err
+}
+
+func (r *cborReader) stringOf(major byte) ([]byte, error) {
+	start := r.pos
+	m, n, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if m != major {
+		r.pos = start
+		return nil, fmt.Errorf("expected %s, found %s", cborMajorName(major), cborMajorName(m))
+	}
+	if n > uint64(len(r.data)-r.pos) {
+		r.pos = len(r.data)
+		return nil, errCBORShort
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
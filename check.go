@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+	"github.com/fxamacker/cbor/v2"
+)
+
+var checkCommand = &command{
+	name:    "check",
+	summary: "Check that a user share or backup key is structurally sound enough to sign with.\n\nThe share's config is checked field by field: the public key must be a point on secp256k1 other than the identity, the secret share a nonzero scalar below the curve order, the chain key 32 bytes long, and the correlated OT setup must have the expected dimensions without degenerate values. No secret material is printed.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var share shareInput
+		share.register(fs, "share", "share")
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -share-* flags")
+			}
+			data, err := share.readOrPrompt()
+			if err != nil {
+				return err
+			}
+			loaded, err := classifyShare(data, true)
+			if err != nil {
+				return err
+			}
+
+			var report *healthReport
+			switch {
+			case loaded.dkls != nil && loaded.dklsParams.IsReceiver:
+				report, err = checkConfig(loaded.dklsParams.ReceiverConfig, true, true)
+			case loaded.dkls != nil:
+				report, err = checkConfig(loaded.dklsParams.SenderConfig, false, true)
+			case loaded.backupKey != "":
+				report, err = checkConfig(loaded.backupKey, false, false)
+			default:
+				return errors.New("only DKLS shares can be checked")
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("format: %s\n", loaded.describe())
+			report.print(os.Stdout)
+			if failed := report.failed(); failed > 0 {
+				return fmt.Errorf("the share failed %d check(s) and can't be relied on", failed)
+			}
+			return nil
+		}
+	},
+}
+
+// healthResult is the outcome of one structural check.
+type healthResult struct {
+	ok  bool
+	msg string
+}
+
+// healthReport lists the checks run on a config.
+type healthReport struct {
+	isReceiver bool
+	results    []healthResult
+	notes      []string
+}
+
+func (r *healthReport) pass(format string, a ...any) {
+	r.results = append(r.results, healthResult{ok: true, msg: fmt.Sprintf(format, a...)})
+}
+
+func (r *healthReport) fail(format string, a ...any) {
+	r.results = append(r.results, healthResult{msg: fmt.Sprintf(format, a...)})
+}
+
+func (r *healthReport) failed() int {
+	n := 0
+	for _, res := range r.results {
+		if !res.ok {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *healthReport) print(w io.Writer) {
+	fmt.Fprintf(w, "role:   %s\n", roleName(r.isReceiver))
+	for _, res := range r.results {
+		status := "ok  "
+		if !res.ok {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%s  %s\n", status, res.msg)
+	}
+	for _, note := range r.notes {
+		fmt.Fprintf(w, "note  %s\n", note)
+	}
+}
+
+// checkConfig runs the structural checks on a base64 encoded DKLS config.
+// Unless roleKnown is set, the role is told apart by the size of the Setup.
+// An error is only returned when the config isn't a cbor map at all.
+func checkConfig(config string, isReceiver, roleKnown bool) (*healthReport, error) {
+	raw, err := base64.StdEncoding.DecodeString(config)
+	if err != nil {
+		return nil, fmt.Errorf("the config is not valid base64: %w", err)
+	}
+	var fields map[string]cbor.RawMessage
+	if err := cbor.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("the config is not a cbor map, run the diagnose command to find the damage: %w", err)
+	}
+	field := func(name string) ([]byte, bool, error) {
+		value, ok := fields[name]
+		if !ok {
+			return nil, false, nil
+		}
+		var b []byte
+		err := cbor.Unmarshal(value, &b)
+		return b, b != nil, err
+	}
+
+	r := &healthReport{isReceiver: isReceiver}
+	setup, hasSetup, setupErr := field("Setup")
+	if !roleKnown {
+		r.isReceiver = len(setup) != senderSetupBytes
+	}
+
+	for name := range fields {
+		switch name {
+		case "Setup", "SecretShare", "Public", "ChainKey":
+		default:
+			r.fail("unexpected field %q", name)
+		}
+	}
+
+	secret, hasSecret, err := field("SecretShare")
+	switch {
+	case err != nil || !hasSecret:
+		r.fail("SecretShare is missing or not a byte string")
+	default:
+		checkScalar(r, secret)
+	}
+
+	public, hasPublic, err := field("Public")
+	var publicPoint curve.Point
+	switch {
+	case err != nil || !hasPublic:
+		r.fail("Public is missing or not a byte string")
+	default:
+		publicPoint = checkPoint(r, public)
+	}
+	if publicPoint != nil && hasSecret && len(secret) == scalarBytes {
+		s := curve.Secp256k1{}.NewScalar()
+		if s.UnmarshalBinary(secret) == nil && s.ActOnBase().Equal(publicPoint) {
+			r.fail("SecretShare alone is the key behind Public, the share is not split")
+		}
+	}
+
+	chainKey, hasChainKey, err := field("ChainKey")
+	switch {
+	case err != nil:
+		r.fail("ChainKey is not a byte string")
+	case !hasChainKey:
+		r.notes = append(r.notes, "the config has no ChainKey, keys can't be derived from it")
+	case len(chainKey) != chainKeyBytes:
+		r.fail("ChainKey is %d bytes long instead of %d", len(chainKey), chainKeyBytes)
+	default:
+		r.pass("ChainKey is %d bytes long", chainKeyBytes)
+	}
+
+	switch {
+	case setupErr != nil || !hasSetup:
+		r.fail("Setup is missing or not a byte string")
+	case r.isReceiver:
+		checkReceiverSetup(r, setup)
+	default:
+		checkSenderSetup(r, setup)
+	}
+
+	if _, err := decodeShareConfig(config, r.isReceiver); err != nil {
+		r.fail("the config doesn't deserialize as a %s config: %v", roleName(r.isReceiver), err)
+	} else {
+		r.pass("the config deserializes as a %s config", roleName(r.isReceiver))
+	}
+	return r, nil
+}
+
+func checkScalar(r *healthReport, b []byte) {
+	if len(b) != scalarBytes {
+		r.fail("SecretShare is %d bytes long instead of %d", len(b), scalarBytes)
+		return
+	}
+	s := curve.Secp256k1{}.NewScalar()
+	if err := s.UnmarshalBinary(b); err != nil {
+		r.fail("SecretShare is not below the curve order")
+		return
+	}
+	if s.IsZero() {
+		r.fail("SecretShare is zero")
+		return
+	}
+	r.pass("SecretShare is a nonzero scalar below the curve order")
+}
+
+func checkPoint(r *healthReport, b []byte) curve.Point {
+	if len(b) != pointBytes {
+		r.fail("Public is %d bytes long instead of %d", len(b), pointBytes)
+		return nil
+	}
+	if b[0] != 2 && b[0] != 3 {
+		r.fail("Public has prefix 0x%02x, which is not a compressed point", b[0])
+		return nil
+	}
+	p := curve.Secp256k1{}.NewPoint()
+	if err := p.UnmarshalBinary(b); err != nil {
+		r.fail("Public is not a point on secp256k1")
+		return nil
+	}
+	if p.IsIdentity() {
+		r.fail("Public is the identity point")
+		return nil
+	}
+	r.pass("Public is a point on secp256k1 other than the identity")
+	return p
+}
+
+// checkSenderSetup checks a CorreOTSendSetup: otBytes of choice bits followed
+// by a cbor array of otParam columns.
+func checkSenderSetup(r *healthReport, setup []byte) {
+	if len(setup) < otBytes {
+		r.fail("Setup is %d bytes long, too short for the %d bytes of choice bits", len(setup), otBytes)
+		return
+	}
+	delta := setup[:otBytes]
+	var columns [][]byte
+	if err := cbor.Unmarshal(setup[otBytes:], &columns); err != nil {
+		r.fail("Setup doesn't hold an array of OT columns: %v", err)
+		return
+	}
+	if !checkColumns(r, "Setup", columns) {
+		return
+	}
+	r.pass("Setup holds %d choice bits and %d columns of %d bytes", otParam, otParam, otBytes)
+
+	switch {
+	case bytes.Equal(delta, make([]byte, otBytes)):
+		r.fail("the Setup choice bits are all zero")
+	case bytes.Equal(delta, bytes.Repeat([]byte{0xff}, otBytes)):
+		r.fail("the Setup choice bits are all one")
+	default:
+		r.pass("the Setup choice bits are not degenerate")
+	}
+}
+
+// checkReceiverSetup checks a CorreOTReceiveSetup: the two cbor arrays of
+// otParam columns the sender picks from.
+func checkReceiverSetup(r *healthReport, setup []byte) {
+	var k0, k1 [][]byte
+	rest, err := cbor.UnmarshalFirst(setup, &k0)
+	if err == nil {
+		err = cbor.Unmarshal(rest, &k1)
+	}
+	if err != nil {
+		r.fail("Setup doesn't hold two arrays of OT columns: %v", err)
+		return
+	}
+	if !checkColumns(r, "Setup K0", k0) || !checkColumns(r, "Setup K1", k1) {
+		return
+	}
+	r.pass("Setup holds 2 x %d columns of %d bytes", otParam, otBytes)
+
+	same := 0
+	for i := range k0 {
+		if bytes.Equal(k0[i], k1[i]) {
+			same++
+		}
+	}
+	if same > 0 {
+		r.fail("%d column(s) of Setup K0 and K1 are equal, the sender's choice bits can't be hidden", same)
+	} else {
+		r.pass("the Setup K0 and K1 columns all differ")
+	}
+}
+
+// checkColumns checks the dimensions of an array of OT columns and that no
+// column is zero or repeated.
+func checkColumns(r *healthReport, name string, columns [][]byte) bool {
+	if len(columns) != otParam {
+		r.fail("%s has %d columns instead of %d", name, len(columns), otParam)
+		return false
+	}
+	seen := make(map[string]int, len(columns))
+	zero := make([]byte, otBytes)
+	for i, col := range columns {
+		if len(col) != otBytes {
+			r.fail("%s column %d is %d bytes long instead of %d", name, i, len(col), otBytes)
+			return false
+		}
+		if bytes.Equal(col, zero) {
+			r.fail("%s column %d is all zero", name, i)
+			return false
+		}
+		if j, ok := seen[string(col)]; ok {
+			r.fail("%s columns %d and %d are equal", name, j, i)
+			return false
+		}
+		seen[string(col)] = i
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	mpcsigner "github.com/capsule-org/go-sdk/signer"
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+	"github.com/capsule-org/multi-party-sig/protocols/doerner"
+)
+
+// childPath is the -child flag of the commands that can act for a child key
+// of the wallet instead of its root key.
+type childPath struct {
+	steps []uint32
+}
+
+func (c *childPath) register(fs *flag.FlagSet) {
+	fs.Var(c, "child", "act for the child key at the non-hardened BIP32 `path` instead of the wallet's root key, such as m/0")
+}
+
+func (c *childPath) String() string {
+	if c == nil || c.steps == nil {
+		return ""
+	}
+	return formatPath(c.steps)
+}
+
+func (c *childPath) Set(s string) error {
+	path, err := parseDerivationPath(s)
+	if err != nil {
+		return err
+	}
+	if path.indexed {
+		return fmt.Errorf("path %q has to name one key, not a range", s)
+	}
+	for _, i := range path.steps {
+		if i >= hardenedOffset {
+			return fmt.Errorf("path %q has a hardened step, which needs the root private key", s)
+		}
+	}
+	c.steps = append([]uint32{}, path.steps...)
+	return nil
+}
+
+// deriveChild shifts both halves of the wallet to the child key at path,
+// without combining their secret shares. The BIP32 tweak is added to the
+// receiver's secret share alone, so the two shares add up to the child key,
+// while both get the child's public key and chain key. The OT setups stay
+// as they are. The vendored Derive can't be used: it adds the tweak to
+// whichever share it's called on, and drops the chain key.
+func (p *walletPair) deriveChild(path []uint32) (*walletPair, error) {
+	if len(path) == 0 {
+		return p, nil
+	}
+	key, err := newRootKey(nil, p.userKey.public, p.userKey.chainKey)
+	if err != nil {
+		return nil, err
+	}
+	total := curve.Secp256k1{}.NewScalar()
+	for _, i := range path {
+		var tweak curve.Scalar
+		if key, tweak, err = key.childWithTweak(i); err != nil {
+			return nil, fmt.Errorf("deriving %s: %w", formatPath(path), err)
+		}
+		total.Add(tweak)
+	}
+
+	user, err := deriveSigner(p.user, total, key)
+	if err != nil {
+		return nil, err
+	}
+	backup, err := deriveSigner(p.backup, total, key)
+	if err != nil {
+		return nil, err
+	}
+	userKey, err := signerShare(user)
+	if err != nil {
+		return nil, err
+	}
+	child := &walletPair{user: user, backup: backup, userKey: userKey, backupWalletId: p.backupWalletId}
+	address, err := child.address()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "using child key %s of the wallet, address %s\n", formatPath(path), address.Hex())
+	return child, nil
+}
+
+// deriveSigner returns the signer of one half of the wallet for a child key,
+// adding the tweak to the secret share if it's the receiver's.
+func deriveSigner(s *mpcsigner.DKLSSigner, tweak curve.Scalar, child *extendedKey) (*mpcsigner.DKLSSigner, error) {
+	var derived mpcsigner.DKLSSigner
+	if receiver := s.GetReceiverConfigStruct(); receiver != nil {
+		config := &doerner.ConfigReceiver{
+			Setup:       receiver.Setup,
+			SecretShare: curve.Secp256k1{}.NewScalar().Set(receiver.SecretShare).Add(tweak),
+			Public:      child.public,
+			ChainKey:    child.chainCode,
+		}
+		derived = mpcsigner.NewDKLSSigner("", s.GetWalletId(), string(s.GetPartyId()), string(s.GetOtherId()), nil, config, nil, true, nil)
+	} else if sender := s.GetSenderConfigStruct(); sender != nil {
+		config := &doerner.ConfigSender{
+			Setup:       sender.Setup,
+			SecretShare: sender.SecretShare,
+			Public:      child.public,
+			ChainKey:    child.chainCode,
+		}
+		derived = mpcsigner.NewDKLSSigner("", s.GetWalletId(), string(s.GetPartyId()), string(s.GetOtherId()), nil, nil, config, false, nil)
+	} else {
+		return nil, fmt.Errorf("the signer of party %s has no config", s.GetPartyId())
+	}
+	return &derived, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mpcsigner "github.com/capsule-org/go-sdk/signer"
+	"github.com/capsule-org/multi-party-sig/pkg/ecdsa"
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+	"github.com/capsule-org/multi-party-sig/pkg/protocol"
+	"github.com/capsule-org/multi-party-sig/protocols/doerner"
+)
+
+// cosignTimeout bounds a signing run whose messages stop flowing, which only
+// happens when one side drops a message instead of aborting.
+const cosignTimeout = 2 * time.Minute
+
+// cosign runs the DKLS signing protocol between the two halves of a wallet
+// in-process, passing the messages between them in memory instead of over
+// the network. The signature is checked against the wallet's public key, so
+// a successful run shows both configs, OT setups included, still sign.
+func cosign(receiver, sender *mpcsigner.DKLSSigner, public curve.Point, hash []byte) (*ecdsa.Signature, error) {
+	receiverConfig := receiver.GetReceiverConfigStruct()
+	senderConfig := sender.GetSenderConfigStruct()
+	if receiverConfig == nil || senderConfig == nil {
+		return nil, errors.New("the shares don't hold a receiver and a sender config")
+	}
+
+	sessionID := make([]byte, 32)
+	if _, err := rand.Read(sessionID); err != nil {
+		return nil, err
+	}
+
+	// The receiver leads: its first round needs no message and goes out as
+	// soon as the handler is created.
+	receiverHandler, err := protocol.NewTwoPartyHandler(doerner.SignReceiver(receiverConfig, receiver.GetPartyId(), receiver.GetOtherId(), hash, nil), sessionID, true)
+	if err != nil {
+		return nil, err
+	}
+	senderHandler, err := protocol.NewTwoPartyHandler(doerner.SignSender(senderConfig, sender.GetPartyId(), sender.GetOtherId(), hash, nil), sessionID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each handler closes its channel once it has a result or has aborted,
+	// after telling the other side why.
+	var wg sync.WaitGroup
+	pump := func(from, to *protocol.TwoPartyHandler) {
+		defer wg.Done()
+		for msg := range from.Listen() {
+			to.Accept(msg)
+		}
+	}
+	wg.Add(2)
+	go pump(receiverHandler, senderHandler)
+	go pump(senderHandler, receiverHandler)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(cosignTimeout):
+		return nil, errors.New("the signing protocol stalled")
+	}
+
+	var sig *ecdsa.Signature
+	for _, h := range []struct {
+		role    string
+		handler *protocol.TwoPartyHandler
+	}{{"receiver", receiverHandler}, {"sender", senderHandler}} {
+		result, err := h.handler.Result()
+		if err != nil {
+			return nil, fmt.Errorf("the %s failed to sign: %w", h.role, err)
+		}
+		s, ok := result.(*ecdsa.Signature)
+		if !ok {
+			return nil, fmt.Errorf("the %s returned a %T instead of a signature", h.role, result)
+		}
+		if !s.Verify(public, hash) {
+			return nil, fmt.Errorf("the %s's signature doesn't verify against the public key", h.role)
+		}
+		sig = s
+	}
+	return sig, nil
+}
+
+// testCosign co-signs a random hash with the two halves of a wallet.
+func testCosign(user, backup *mpcsigner.DKLSSigner, userKey *dklsShare) error {
+	hash := make([]byte, 32)
+	if _, err := rand.Read(hash); err != nil {
+		return err
+	}
+	receiver, sender := user, backup
+	if !userKey.isReceiver {
+		receiver, sender = backup, user
+	}
+	_, err := cosign(receiver, sender, userKey.public, hash)
+	return err
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+)
+
+var diagnoseCommand = &command{
+	name:    "diagnose",
+	summary: "Locate the characters that break a mistyped or damaged Capsule backup key.\n\nThe key is decoded step by step and its structure is compared with a DKLS config, so the first place where it goes wrong can be compared with the pdf. With a user share, the key's values are checked against the wallet as well.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var userShare, backupShare shareInput
+		userShare.register(fs, "user-share", "user share")
+		backupShare.register(fs, "backup-share", "Capsule backup share")
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("unexpected arguments")
+			}
+			if err := checkStdin(&userShare, &backupShare); err != nil {
+				return err
+			}
+
+			backup, err := loadBackupShare(&backupShare)
+			if err != nil {
+				return err
+			}
+			var userKey *dklsShare
+			if userShare.isSet() {
+				user, err := loadUserShare(&userShare)
+				if err != nil {
+					return err
+				}
+				userSigner, err := user.dklsUserSigner()
+				if err != nil {
+					return err
+				}
+				if userKey, err = signerShare(userSigner); err != nil {
+					return err
+				}
+			}
+
+			key, err := backup.backupConfig(userKey != nil && userKey.isReceiver)
+			if err != nil {
+				return err
+			}
+
+			report := diagnoseBackupKey(key, userKey)
+			report.print(os.Stdout)
+			if report.mismatch != "" {
+				return fmt.Errorf("the backup key doesn't belong with the user share")
+			}
+			if !report.ok() {
+				return fmt.Errorf("the backup key is damaged")
+			}
+			return nil
+		}
+	},
+}
+
+// Expected layout of a serialized doerner.ConfigReceiver.
+const (
+	scalarBytes   = 32
+	pointBytes    = 33
+	chainKeyBytes = 32
+	configMapSize = 4
+
+	// the receiver's Setup holds two arrays of OT columns, the sender's its
+	// choice bits and one array
+	otArrayBytes       = 2 + otParam*(1+otBytes)
+	receiverSetupBytes = 2 * otArrayBytes
+	senderSetupBytes   = otBytes + otArrayBytes
+)
+
+// keyPosition locates a character of the backup key as it was entered.
+type keyPosition struct {
+	// index is the offset in the key with whitespace removed.
+	index, line, column int
+}
+
+func (p keyPosition) String() string {
+	return fmt.Sprintf("character %d (line %d, column %d)", p.index, p.line, p.column)
+}
+
+// keyFinding is one problem found in a backup key.
+type keyFinding struct {
+	// start and end delimit the affected characters of the key.
+	start, end keyPosition
+	msg        string
+}
+
+// keyDiagnosis is the result of diagnoseBackupKey.
+type keyDiagnosis struct {
+	chars    int
+	findings []keyFinding
+	notes    []string
+	// mismatch explains why an intact key doesn't go with the user share.
+	mismatch string
+}
+
+func (d *keyDiagnosis) ok() bool {
+	return len(d.findings) == 0 && d.mismatch == ""
+}
+
+func (d *keyDiagnosis) print(w io.Writer) {
+	fmt.Fprintf(w, "backup key: %d base64 characters\n", d.chars)
+	for _, note := range d.notes {
+		fmt.Fprintf(w, "  %s\n", note)
+	}
+	if d.mismatch != "" {
+		fmt.Fprintf(w, "the key is intact, but %s\n", d.mismatch)
+		return
+	}
+	if d.ok() {
+		fmt.Fprintln(w, "no problems found")
+		return
+	}
+	for i, f := range d.findings {
+		prefix := "problem"
+		if i == 0 {
+			prefix = "first problem"
+		}
+		if f.start.index == f.end.index {
+			fmt.Fprintf(w, "%s at %s: %s\n", prefix, f.start, f.msg)
+		} else {
+			fmt.Fprintf(w, "%s at %s to %s: %s\n", prefix, f.start, f.end, f.msg)
+		}
+	}
+}
+
+// keyLayout maps offsets in the whitespace-free key back to the input.
+type keyLayout struct {
+	key       string
+	positions []keyPosition
+}
+
+func newKeyLayout(input string) *keyLayout {
+	l := &keyLayout{}
+	var key strings.Builder
+	line, column := 1, 1
+	for _, r := range input {
+		switch {
+		case r == '\n':
+			line++
+			column = 1
+			continue
+		case r == ' ' || r == '\t' || r == '\r':
+			column++
+			continue
+		}
+		l.positions = append(l.positions, keyPosition{index: len(l.positions), line: line, column: column})
+		key.WriteRune(r)
+		column++
+	}
+	l.key = key.String()
+	return l
+}
+
+func (l *keyLayout) at(i int) keyPosition {
+	if len(l.positions) == 0 {
+		return keyPosition{line: 1, column: 1}
+	}
+	if i >= len(l.positions) {
+		last := l.positions[len(l.positions)-1]
+		return keyPosition{index: i, line: last.line, column: last.column + i - last.index}
+	}
+	return l.positions[i]
+}
+
+// byteRange returns the characters that encode the decoded bytes [start, end).
+func (l *keyLayout) byteRange(start, end int) (keyPosition, keyPosition) {
+	first := start / 3 * 4
+	last := (max(end, start+1)-1)/3*4 + 3
+	return l.at(first), l.at(last)
+}
+
+// diagnoseBackupKey decodes a backup key step by step and reports where it
+// stops being a valid DKLS config. If the user's share is known, the key is
+// expected in the opposite role and its decoded values are compared with the
+// share as well. Otherwise the role is told apart by the size of the Setup.
+func diagnoseBackupKey(input string, user *dklsShare) *keyDiagnosis {
+	layout := newKeyLayout(input)
+	d := &keyDiagnosis{}
+
+	// characters are checked in terms of runes, as the pdf copy may contain
+	// multi-byte lookalikes
+	runes := []rune(layout.key)
+	d.chars = len(runes)
+	valid := len(runes)
+	for i, r := range runes {
+		if r == '=' {
+			if i < len(runes)-2 || (i == len(runes)-2 && runes[i+1] != '=') {
+				d.findings = append(d.findings, keyFinding{start: layout.at(i), end: layout.at(i), msg: "padding \"=\" in the middle of the key"})
+				valid = i
+				break
+			}
+			continue
+		}
+		if r >= 0x80 || !strings.ContainsRune(base64Alphabet, r) {
+			d.findings = append(d.findings, keyFinding{start: layout.at(i), end: layout.at(i), msg: fmt.Sprintf("%q is not a base64 character", r)})
+			valid = i
+			break
+		}
+	}
+	if valid == len(runes) && len(runes)%4 != 0 {
+		extra := len(runes) % 4
+		d.notes = append(d.notes, fmt.Sprintf("the key length is not a multiple of 4, it has %d character(s) too many or %d too few", extra, 4-extra))
+	}
+
+	// decode the longest prefix of whole base64 groups that's left and walk it
+	prefix := string(runes[:valid/4*4])
+	raw, err := base64.StdEncoding.DecodeString(prefix)
+	if err != nil {
+		// only the final group can fail to decode, due to its padding
+		prefix = prefix[:max(0, len(prefix)-4)]
+		raw, _ = base64.StdEncoding.DecodeString(prefix)
+	}
+
+	w := &configWalk{cborReader: cborReader{data: raw}, layout: layout, complete: valid == len(runes) && len(runes)%4 == 0}
+	if user != nil {
+		w.roleKnown, w.isReceiver = true, !user.isReceiver
+	}
+	if f := w.walk(); f != nil {
+		// a structural break can come before a bad character further on
+		d.findings = append([]keyFinding{*f}, d.findings...)
+		return d
+	}
+	if !w.complete {
+		return d
+	}
+	d.notes = append(d.notes, fmt.Sprintf("the key decodes to a structurally valid %s config", roleName(w.isReceiver)))
+
+	if user != nil {
+		// a key from another refresh differs everywhere, which is not damage
+		config, err := decodeShareConfig(base64.StdEncoding.EncodeToString(w.data), w.isReceiver)
+		if err == nil && user.refreshedApart(config) {
+			d.mismatch = errRefreshGeneration.Error()
+			return d
+		}
+		d.findings = append(d.findings, w.compare(user)...)
+		if w.isReceiver {
+			d.notes = append(d.notes, "only the Setup columns picked by the user share's OT choice bits can be checked, the other half can't be verified")
+		}
+	}
+	return d
+}
+
+// configWalk follows the cbor encoding of a doerner.ConfigReceiver or
+// ConfigSender, recording where each field's bytes are.
+type configWalk struct {
+	cborReader
+	layout *keyLayout
+	// complete is false when the bytes are only a prefix of the key, in which
+	// case running out of data isn't a problem by itself.
+	complete bool
+
+	// isReceiver is the role of the config, taken from the Setup unless
+	// roleKnown is set.
+	isReceiver, roleKnown bool
+
+	setup, secretShare, public, chainKey, delta [2]int
+	// setupColumns holds the receiver's two arrays, or the sender's one.
+	setupColumns [2][otParam]int
+}
+
+func (w *configWalk) finding(start, end int, format string, a ...any) *keyFinding {
+	s, e := w.layout.byteRange(start, end)
+	return &keyFinding{start: s, end: e, msg: fmt.Sprintf(format, a...)}
+}
+
+// fail turns a cbor read error into a finding. Running out of data on a key
+// that was only decoded up to an earlier problem is not a finding of its own.
+func (w *configWalk) fail(err error, what string) *keyFinding {
+	if err == errCBORShort && !w.complete {
+		return nil
+	}
+	if err == errCBORShort {
+		return w.finding(len(w.data), len(w.data), "the key ends in the middle of %s", what)
+	}
+	return w.finding(w.pos, w.pos+1, "%s: %v", what, err)
+}
+
+func (w *configWalk) walk() *keyFinding {
+	start := w.pos
+	major, n, err := w.head()
+	if err != nil {
+		return w.fail(err, "the config header")
+	}
+	if major != cborMap {
+		return w.finding(start, w.pos, "the config should start with a cbor map, found %s", cborMajorName(major))
+	}
+	if n != configMapSize {
+		return w.finding(start, w.pos, "the config should have %d fields, found %d", configMapSize, n)
+	}
+
+	seen := map[string]bool{}
+	for i := uint64(0); i < n; i++ {
+		keyStart := w.pos
+		name, err := w.text()
+		if err != nil {
+			return w.fail(err, "a field name")
+		}
+		if seen[name] {
+			return w.finding(keyStart, w.pos, "field %q appears twice", name)
+		}
+		seen[name] = true
+
+		var f *keyFinding
+		switch name {
+		case "Setup":
+			f = w.walkSetup()
+		case "SecretShare":
+			f = w.walkBytes(name, scalarBytes, &w.secretShare, func(b []byte) error {
+				return w.groupScalar(b)
+			})
+		case "Public":
+			f = w.walkBytes(name, pointBytes, &w.public, func(b []byte) error {
+				if b[0] != 2 && b[0] != 3 {
+					return fmt.Errorf("compressed point prefix is 0x%02x instead of 0x02 or 0x03", b[0])
+				}
+				return curve.Secp256k1{}.NewPoint().UnmarshalBinary(b)
+			})
+		case "ChainKey":
+			if w.pos < len(w.data) && w.data[w.pos] == cborNull {
+				w.pos++
+				continue
+			}
+			f = w.walkBytes(name, chainKeyBytes, &w.chainKey, nil)
+		default:
+			return w.finding(keyStart, w.pos, "unexpected field name %q", name)
+		}
+		if f != nil {
+			return f
+		}
+	}
+
+	if w.complete && w.pos != len(w.data) {
+		return w.finding(w.pos, len(w.data), "%d unexpected byte(s) after the end of the config", len(w.data)-w.pos)
+	}
+	return nil
+}
+
+func (w *configWalk) groupScalar(b []byte) error {
+	s := curve.Secp256k1{}.NewScalar()
+	if err := s.UnmarshalBinary(b); err != nil {
+		return fmt.Errorf("value is not below the curve order")
+	}
+	if s.IsZero() {
+		return fmt.Errorf("value is zero")
+	}
+	return nil
+}
+
+func (w *configWalk) walkBytes(name string, size int, at *[2]int, check func([]byte) error) *keyFinding {
+	start := w.pos
+	b, err := w.bytes()
+	if err != nil {
+		return w.fail(err, name)
+	}
+	at[0], at[1] = w.pos-len(b), w.pos
+	if len(b) != size {
+		return w.finding(start, w.pos, "%s should be %d bytes, found %d", name, size, len(b))
+	}
+	if check != nil {
+		if err := check(b); err != nil {
+			return w.finding(at[0], at[1], "%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// walkSetup follows the OT setup: for the receiver a byte string holding two
+// cbor arrays of otParam byte strings of otBytes each, for the sender its
+// otBytes of choice bits followed by one such array.
+func (w *configWalk) walkSetup() *keyFinding {
+	start := w.pos
+	setup, err := w.bytes()
+	if err != nil {
+		return w.fail(err, "Setup")
+	}
+	end := w.pos
+	w.setup = [2]int{end - len(setup), end}
+	if !w.roleKnown {
+		w.roleKnown, w.isReceiver = true, len(setup) != senderSetupBytes
+	}
+	if len(setup) == 0 {
+		return w.finding(start, end, "Setup is empty")
+	}
+
+	inner := &configWalk{cborReader: cborReader{data: w.data[:end], pos: w.setup[0]}, layout: w.layout, complete: true}
+	arrays := 2
+	if !w.isReceiver {
+		if len(setup) < otBytes {
+			return w.finding(start, end, "Setup should start with %d bytes of choice bits, found %d bytes", otBytes, len(setup))
+		}
+		w.delta = [2]int{inner.pos, inner.pos + otBytes}
+		inner.pos += otBytes
+		arrays = 1
+	}
+	for half := 0; half < arrays; half++ {
+		arrStart := inner.pos
+		major, n, err := inner.head()
+		if err != nil {
+			return inner.fail(err, "Setup")
+		}
+		if major != cborArray || n != otParam {
+			return inner.finding(arrStart, inner.pos, "Setup should hold arrays of %d columns, found %s of %d", otParam, cborMajorName(major), n)
+		}
+		for i := 0; i < otParam; i++ {
+			colStart := inner.pos
+			col, err := inner.bytes()
+			if err != nil {
+				return inner.fail(err, fmt.Sprintf("Setup column %d", i))
+			}
+			if len(col) != otBytes {
+				return inner.finding(colStart, inner.pos, "Setup column %d should be %d bytes, found %d", i, otBytes, len(col))
+			}
+			w.setupColumns[half][i] = inner.pos - otBytes
+		}
+	}
+	if inner.pos != end {
+		return w.finding(inner.pos, end, "%d unexpected byte(s) at the end of Setup", end-inner.pos)
+	}
+	return nil
+}
+
+// compare checks the decoded values against the user's share.
+func (w *configWalk) compare(user *dklsShare) []keyFinding {
+	var findings []keyFinding
+	config, err := decodeShareConfig(base64.StdEncoding.EncodeToString(w.data), w.isReceiver)
+	if err != nil {
+		return []keyFinding{*w.finding(0, len(w.data), "the config doesn't decode: %v", err)}
+	}
+
+	if !config.public.Equal(user.public) {
+		findings = append(findings, *w.finding(w.public[0], w.public[1], "Public doesn't match the user share's public key"))
+	} else if !config.secretShare.ActOnBase().Add(user.secretShare.ActOnBase()).Equal(user.public) {
+		findings = append(findings, *w.finding(w.secretShare[0], w.secretShare[1], "SecretShare doesn't complete the user share to the public key"))
+	}
+
+	if !bytes.Equal(config.chainKey, user.chainKey) {
+		findings = append(findings, *w.finding(w.chainKey[0], w.chainKey[1], "ChainKey doesn't match the user share's chain key"))
+	}
+
+	if w.isReceiver {
+		for i := 0; i < otParam; i++ {
+			bit := user.send.deltaBit(i)
+			want := config.recv.k0[i]
+			if bit == 1 {
+				want = config.recv.k1[i]
+			}
+			if user.send.kDelta[i] != want {
+				at := w.setupColumns[bit][i]
+				findings = append(findings, *w.finding(at, at+otBytes, "Setup column %d doesn't match the user share's OT setup", i))
+			}
+		}
+		return findings
+	}
+
+	// the user holds both columns the sender chooses from, so a mismatch
+	// tells a damaged column apart from a damaged choice bit
+	for i := 0; i < otParam; i++ {
+		bit := config.send.deltaBit(i)
+		chosen, other := user.recv.k0[i], user.recv.k1[i]
+		if bit == 1 {
+			chosen, other = other, chosen
+		}
+		switch config.send.kDelta[i] {
+		case chosen:
+		case other:
+			at := w.delta[0] + i/8
+			findings = append(findings, *w.finding(at, at+1, "choice bit %d of Setup doesn't match the user share's OT setup", i))
+		default:
+			at := w.setupColumns[0][i]
+			findings = append(findings, *w.finding(at, at+otBytes, "Setup column %d doesn't match the user share's OT setup", i))
+		}
+	}
+	return findings
+}
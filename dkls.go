@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+
+	mpcsigner "github.com/capsule-org/go-sdk/signer"
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+)
+
+// nullConfig is the base64 cbor null a DKLS signer stores for the config of
+// the role it doesn't hold.
+const nullConfig = "9g=="
+
+// Party IDs used by wallets whose shares don't record them.
+const (
+	defaultUserId   = "USER"
+	defaultBackupId = "CAPSULE"
+)
+
+// roleName returns the DKLS role of a share for messages.
+func roleName(isReceiver bool) string {
+	if isReceiver {
+		return "receiver"
+	}
+	return "sender"
+}
+
+// dklsShare holds the fields both roles of a DKLS share have in common,
+// along with the OT setup of its own role.
+type dklsShare struct {
+	isReceiver  bool
+	secretShare curve.Scalar
+	public      curve.Point
+	chainKey    []byte
+	// send is set for the sender, recv for the receiver.
+	send *otSendSetup
+	recv *otReceiveSetup
+}
+
+// signerShare returns the share held by a DKLS signer.
+func signerShare(signer *mpcsigner.DKLSSigner) (*dklsShare, error) {
+	if sender := signer.GetSenderConfigStruct(); sender != nil {
+		setup, err := decodeOTSendSetup(sender.Setup)
+		if err != nil {
+			return nil, err
+		}
+		return &dklsShare{secretShare: sender.SecretShare, public: sender.Public, chainKey: sender.ChainKey, send: setup}, nil
+	}
+	if receiver := signer.GetReceiverConfigStruct(); receiver != nil {
+		setup, err := decodeOTReceiveSetup(receiver.Setup)
+		if err != nil {
+			return nil, err
+		}
+		return &dklsShare{isReceiver: true, secretShare: receiver.SecretShare, public: receiver.Public, chainKey: receiver.ChainKey, recv: setup}, nil
+	}
+	return nil, errors.New("the signer holds neither a sender nor a receiver config")
+}
+
+// decodeShareConfig decodes a base64 encoded config of the given role.
+func decodeShareConfig(config string, isReceiver bool) (*dklsShare, error) {
+	if isReceiver {
+		receiver, err := decodeReceiverConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		setup, err := decodeOTReceiveSetup(receiver.Setup)
+		if err != nil {
+			return nil, err
+		}
+		return &dklsShare{isReceiver: true, secretShare: receiver.SecretShare, public: receiver.Public, chainKey: receiver.ChainKey, recv: setup}, nil
+	}
+	sender, err := decodeSenderConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	setup, err := decodeOTSendSetup(sender.Setup)
+	if err != nil {
+		return nil, err
+	}
+	return &dklsShare{secretShare: sender.SecretShare, public: sender.Public, chainKey: sender.ChainKey, send: setup}, nil
+}
+
+// errRefreshGeneration is reported for two shares of one wallet that were
+// saved on different sides of a key refresh.
+var errRefreshGeneration = errors.New("the shares come from different refresh generations of the same wallet: " +
+	"it was refreshed after one of them was saved, so they no longer add up to its key. " +
+	"Use the backup kit issued after the latest refresh together with the current user share")
+
+// completes reports whether the two secret shares add up to the public key.
+func (s *dklsShare) completes(other *dklsShare) bool {
+	return s.secretShare.ActOnBase().Add(other.secretShare.ActOnBase()).Equal(s.public)
+}
+
+// refreshedApart reports whether two shares of the same public key come from
+// different refreshes. A refresh draws new secret shares along with a new
+// chain key and OT setups, so unlike a damaged share none of them agree.
+func (s *dklsShare) refreshedApart(other *dklsShare) bool {
+	if s.isReceiver == other.isReceiver || !s.public.Equal(other.public) || s.completes(other) {
+		return false
+	}
+	return !bytes.Equal(s.chainKey, other.chainKey) || s.otSetupsMatch(other) != nil
+}
+
+func (s *dklsShare) otSetupsMatch(other *dklsShare) error {
+	if s.isReceiver {
+		return otSetupsMatch(other.send, s.recv)
+	}
+	return otSetupsMatch(s.send, other.recv)
+}
+
+// pairs reports why two shares are not the two halves of one wallet, or nil
+// if they are.
+func (s *dklsShare) pairs(other *dklsShare) error {
+	if s.isReceiver == other.isReceiver {
+		return fmt.Errorf("both shares are %ss", roleName(s.isReceiver))
+	}
+	if !s.public.Equal(other.public) {
+		return errors.New("the shares have different public keys")
+	}
+	if s.refreshedApart(other) {
+		return errRefreshGeneration
+	}
+	if !bytes.Equal(s.chainKey, other.chainKey) {
+		return errors.New("the shares have different chain keys")
+	}
+	if err := s.otSetupsMatch(other); err != nil {
+		return err
+	}
+	if !s.completes(other) {
+		return errors.New("the secret shares don't add up to the public key")
+	}
+	return nil
+}
+
+// walletOverrides replaces the wallet and party IDs recorded in a user share,
+// for wallets from other deployments or older SDK versions.
+type walletOverrides struct {
+	walletId, userId, backupId string
+}
+
+func (o *walletOverrides) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.walletId, "wallet-id", "", "use wallet `id` instead of the one recorded in the user share")
+	fs.StringVar(&o.userId, "user-id", "", "use party `id` for the user share instead of its recorded ID")
+	fs.StringVar(&o.backupId, "backup-id", "", "use party `id` for the backup share instead of the user share's recorded other ID")
+}
+
+// apply rewrites the user share's parameters with the overrides and any
+// missing party IDs, and deserializes the signer again.
+func (o *walletOverrides) apply(user *loadedShare) error {
+	if user.dklsParams == nil {
+		return nil
+	}
+	params := *user.dklsParams
+	changed := false
+	set := func(field *string, value, fallback string) {
+		if value == "" && *field == "" {
+			value = fallback
+		}
+		if value != "" && value != *field {
+			*field = value
+			changed = true
+		}
+	}
+	set(&params.WalletId, o.walletId, "")
+	set(&params.Id, o.userId, defaultUserId)
+	set(&params.OtherId, o.backupId, defaultBackupId)
+	if !changed {
+		return nil
+	}
+	if params.Id == params.OtherId {
+		return fmt.Errorf("the user and backup party IDs are both %q", params.Id)
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	signer, err := mpcsigner.DKLSDeserializeSigner(string(data), "")
+	if err != nil {
+		return err
+	}
+	user.dkls, user.dklsParams = signer, &params
+	return nil
+}
+
+// backupWalletId returns the wallet ID a backup share records, if it was
+// given as a complete signer and the wallet ID wasn't overridden for both.
+func (o *walletOverrides) backupWalletId(backup *loadedShare) string {
+	if backup.dklsParams == nil || o.walletId != "" {
+		return ""
+	}
+	return backup.dklsParams.WalletId
+}
+
+// counterpartParams returns the serialized signer of the share that
+// completes user, holding config in the opposite role.
+func counterpartParams(user *mpcsigner.DKLSSerializableSigner, config string) *mpcsigner.DKLSSerializableSigner {
+	params := &mpcsigner.DKLSSerializableSigner{
+		WalletId:       user.WalletId,
+		Id:             user.OtherId,
+		OtherId:        user.Id,
+		IsReceiver:     !user.IsReceiver,
+		ReceiverConfig: nullConfig,
+		SenderConfig:   nullConfig,
+	}
+	if params.IsReceiver {
+		params.ReceiverConfig = config
+	} else {
+		params.SenderConfig = config
+	}
+	return params
+}
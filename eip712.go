@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// eip712Domain is the name of the domain type of EIP-712 typed data.
+const eip712Domain = "EIP712Domain"
+
+// typedData is an EIP-712 document as passed to eth_signTypedData_v4.
+type typedData struct {
+	Types       map[string][]typedField `json:"types"`
+	PrimaryType string                  `json:"primaryType"`
+	Domain      map[string]any          `json:"domain"`
+	Message     map[string]any          `json:"message"`
+}
+
+type typedField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// domainFields are the fields an EIP712Domain type may have, in the order
+// they are listed when a document leaves the type out.
+var domainFields = []typedField{
+	{"name", "string"},
+	{"version", "string"},
+	{"chainId", "uint256"},
+	{"verifyingContract", "address"},
+	{"salt", "bytes32"},
+}
+
+var (
+	arrayTypePattern = regexp.MustCompile(`^(.+)\[([0-9]*)\]$`)
+	intTypePattern   = regexp.MustCompile(`^(u?)int([0-9]*)$`)
+	bytesTypePattern = regexp.MustCompile(`^bytes([0-9]+)$`)
+)
+
+// parseTypedData decodes an EIP-712 JSON document.
+func parseTypedData(data []byte) (*typedData, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var td typedData
+	if err := dec.Decode(&td); err != nil {
+		return nil, fmt.Errorf("the typed data is not valid JSON: %w", err)
+	}
+	if td.Types == nil {
+		return nil, errors.New("the typed data has no types")
+	}
+	if td.PrimaryType == "" {
+		return nil, errors.New("the typed data has no primaryType")
+	}
+	if td.Domain == nil {
+		td.Domain = map[string]any{}
+	}
+	if _, ok := td.Types[eip712Domain]; !ok {
+		for _, f := range domainFields {
+			if _, ok := td.Domain[f.Name]; ok {
+				td.Types[eip712Domain] = append(td.Types[eip712Domain], f)
+			}
+		}
+	}
+	if _, ok := td.Types[td.PrimaryType]; !ok {
+		return nil, fmt.Errorf("the primary type %s is not defined", td.PrimaryType)
+	}
+	for name, fields := range td.Types {
+		for _, f := range fields {
+			base := f.Type
+			for m := arrayTypePattern.FindStringSubmatch(base); m != nil; m = arrayTypePattern.FindStringSubmatch(base) {
+				base = m[1]
+			}
+			if _, ok := td.Types[base]; !ok && !isAtomicType(base) {
+				return nil, fmt.Errorf("field %s of %s has the undefined type %s", f.Name, name, f.Type)
+			}
+		}
+	}
+	return &td, nil
+}
+
+// hashes returns the domain separator, the hash of the message and the
+// digest that is signed. The message hash is nil when the primary type is
+// the domain itself.
+func (td *typedData) hashes() (domainSeparator, messageHash, digest []byte, err error) {
+	domainSeparator, err = td.hashStruct(eip712Domain, td.Domain)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("domain: %w", err)
+	}
+	data := append([]byte("\x19\x01"), domainSeparator...)
+	if td.PrimaryType != eip712Domain {
+		if td.Message == nil {
+			return nil, nil, nil, errors.New("the typed data has no message")
+		}
+		messageHash, err = td.hashStruct(td.PrimaryType, td.Message)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("message: %w", err)
+		}
+		data = append(data, messageHash...)
+	}
+	return domainSeparator, messageHash, crypto.Keccak256(data), nil
+}
+
+// encodeType returns the type string of a struct type, followed by the
+// struct types it references in alphabetical order.
+func (td *typedData) encodeType(name string) string {
+	deps := map[string]bool{}
+	td.dependencies(name, deps)
+	delete(deps, name)
+	names := make([]string, 0, len(deps))
+	for dep := range deps {
+		names = append(names, dep)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, n := range append([]string{name}, names...) {
+		b.WriteString(n + "(")
+		for i, f := range td.Types[n] {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(f.Type + " " + f.Name)
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+func (td *typedData) dependencies(name string, found map[string]bool) {
+	if found[name] {
+		return
+	}
+	if _, ok := td.Types[name]; !ok {
+		return
+	}
+	found[name] = true
+	for _, f := range td.Types[name] {
+		base := f.Type
+		if i := strings.IndexByte(base, '['); i >= 0 {
+			base = base[:i]
+		}
+		td.dependencies(base, found)
+	}
+}
+
+func (td *typedData) hashStruct(name string, data map[string]any) ([]byte, error) {
+	enc := crypto.Keccak256([]byte(td.encodeType(name)))
+	for _, f := range td.Types[name] {
+		value, ok := data[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s.%s is missing", name, f.Name)
+		}
+		word, err := td.encodeValue(f.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", name, f.Name, err)
+		}
+		enc = append(enc, word...)
+	}
+	return crypto.Keccak256(enc), nil
+}
+
+// encodeValue returns the 32-byte encoding of a value of an EIP-712 type.
+func (td *typedData) encodeValue(typ string, value any) ([]byte, error) {
+	if m := arrayTypePattern.FindStringSubmatch(typ); m != nil {
+		items, ok := value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an array for %s", typ)
+		}
+		if m[2] != "" {
+			n, err := strconv.Atoi(m[2])
+			if err != nil || n != len(items) {
+				return nil, fmt.Errorf("expected %s items for %s, got %d", m[2], typ, len(items))
+			}
+		}
+		var enc []byte
+		for i, item := range items {
+			word, err := td.encodeValue(m[1], item)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			enc = append(enc, word...)
+		}
+		return crypto.Keccak256(enc), nil
+	}
+
+	if _, ok := td.Types[typ]; ok {
+		data, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an object for %s", typ)
+		}
+		return td.hashStruct(typ, data)
+	}
+
+	switch typ {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("expected a string")
+		}
+		return crypto.Keccak256([]byte(s)), nil
+	case "bytes":
+		b, err := typedBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(b), nil
+	case "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, errors.New("expected true or false")
+		}
+		word := make([]byte, 32)
+		if b {
+			word[31] = 1
+		}
+		return word, nil
+	case "address":
+		s, ok := value.(string)
+		if !ok || !common.IsHexAddress(s) {
+			return nil, errors.New("expected a hex address")
+		}
+		return common.LeftPadBytes(common.HexToAddress(s).Bytes(), 32), nil
+	}
+
+	if m := bytesTypePattern.FindStringSubmatch(typ); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		b, err := typedBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != n {
+			return nil, fmt.Errorf("expected %d bytes, got %d", n, len(b))
+		}
+		return common.RightPadBytes(b, 32), nil
+	}
+	if m := intTypePattern.FindStringSubmatch(typ); m != nil {
+		bits := 256
+		if m[2] != "" {
+			bits, _ = strconv.Atoi(m[2])
+		}
+		return encodeInt(value, m[1] == "u", bits)
+	}
+	return nil, fmt.Errorf("unknown type %s", typ)
+}
+
+// isAtomicType reports whether typ is one of the EIP-712 atomic or dynamic
+// types rather than a struct.
+func isAtomicType(typ string) bool {
+	switch typ {
+	case "string", "bytes", "bool", "address":
+		return true
+	}
+	if m := bytesTypePattern.FindStringSubmatch(typ); m != nil {
+		n, err := strconv.Atoi(m[1])
+		return err == nil && n >= 1 && n <= 32
+	}
+	if m := intTypePattern.FindStringSubmatch(typ); m != nil {
+		if m[2] == "" {
+			return true
+		}
+		n, err := strconv.Atoi(m[2])
+		return err == nil && n >= 8 && n <= 256 && n%8 == 0
+	}
+	return false
+}
+
+func typedBytes(value any) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, "0x") {
+		return nil, errors.New("expected 0x prefixed hex bytes")
+	}
+	return decodeHex(s)
+}
+
+// encodeInt encodes a number given as a JSON number, a decimal string or a
+// 0x prefixed hex string as a 32-byte two's complement word.
+func encodeInt(value any, unsigned bool, bits int) ([]byte, error) {
+	var s string
+	switch v := value.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	default:
+		return nil, errors.New("expected a number")
+	}
+	digits, negative := strings.CutPrefix(s, "-")
+	base := 10
+	if hexDigits, ok := strings.CutPrefix(strings.ToLower(digits), "0x"); ok {
+		digits, base = hexDigits, 16
+	}
+	n, ok := new(big.Int).SetString(digits, base)
+	if !ok || strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		return nil, fmt.Errorf("%q is not an integer", s)
+	}
+	if negative {
+		n.Neg(n)
+	}
+
+	lo, hi := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if !unsigned {
+		hi.Rsh(hi, 1)
+		lo.Neg(hi)
+	}
+	if n.Cmp(lo) < 0 || n.Cmp(hi) >= 0 {
+		kind := "int"
+		if unsigned {
+			kind = "uint"
+		}
+		return nil, fmt.Errorf("%s is out of range for %s%d", n, kind, bits)
+	}
+	if n.Sign() < 0 {
+		n.Add(n, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	return common.LeftPadBytes(n.Bytes(), 32), nil
+}
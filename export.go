@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	mpcsigner "github.com/capsule-org/go-sdk/signer"
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var exportCommand = &command{
+	name:    "export",
+	summary: "Export the private key of a DKLS wallet from the user share and the Capsule backup share.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var userShare, backupShare shareInput
+		var overrides walletOverrides
+		var output exportOutput
+		var child childPath
+		userShare.register(fs, "user-share", "user share")
+		backupShare.register(fs, "backup-share", "Capsule backup share")
+		overrides.register(fs)
+		output.register(fs)
+		child.register(fs)
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -user-share-* and -backup-share-* flags")
+			}
+			if err := output.check(); err != nil {
+				return err
+			}
+			if err := checkStdin(&userShare, &backupShare); err != nil {
+				return err
+			}
+			return runExport(&userShare, &backupShare, &overrides, &output, child.steps)
+		}
+	},
+}
+
+// exportOutput is how the private key is handed over.
+type exportOutput struct {
+	format, dir, kdf, network string
+}
+
+func (out *exportOutput) register(fs *flag.FlagSet) {
+	fs.StringVar(&out.format, "format", "hex", "the `format` to export the key in: hex to print it, keystore to write a V3 JSON keystore file, or bitcoin to print it as WIF with its Bitcoin addresses and descriptors")
+	fs.StringVar(&out.dir, "keystore-dir", ".", "write the keystore file to `dir`")
+	fs.StringVar(&out.kdf, "kdf", "scrypt", "derive the keystore's encryption key from the passphrase with `kdf` scrypt or pbkdf2")
+	fs.StringVar(&out.network, "network", "mainnet", "encode the bitcoin format for `network` mainnet, testnet, signet or regtest")
+}
+
+// check validates the output flags before any share is read.
+func (out *exportOutput) check() error {
+	switch out.format {
+	case "hex":
+		return nil
+	case "bitcoin":
+		if findBitcoinNetwork(out.network) == nil {
+			return usageErrorf("-network must be mainnet, testnet, signet or regtest")
+		}
+		return nil
+	case "keystore":
+	default:
+		return usageErrorf("-format must be hex, keystore or bitcoin")
+	}
+	if out.kdf != "scrypt" && out.kdf != "pbkdf2" {
+		return usageErrorf("-kdf must be scrypt or pbkdf2")
+	}
+	info, err := os.Stat(out.dir)
+	if err != nil {
+		return usageErrorf("-keystore-dir: %v", err)
+	}
+	if !info.IsDir() {
+		return usageErrorf("-keystore-dir %s is not a directory", out.dir)
+	}
+	return nil
+}
+
+// runExport reconstructs the private key, or the key of the child at path,
+// and prints it or writes it to a keystore. Shares without a configured
+// source are prompted for on the terminal.
+func runExport(userShare, backupShare *shareInput, overrides *walletOverrides, out *exportOutput, path []uint32) error {
+	fmt.Print("\n\n---------------- Generating private key with backup share ----------------\n\n")
+
+	sk, _, err := loadPrivateKey(userShare, backupShare, overrides, path)
+	if err != nil {
+		return err
+	}
+
+	skBytes, err := sk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	switch out.format {
+	case "keystore":
+		return exportKeystore(skBytes, out)
+	case "bitcoin":
+		return printBitcoinKeys(os.Stdout, sk, findBitcoinNetwork(out.network))
+	}
+
+	skHex := hex.EncodeToString(skBytes)
+
+	fmt.Println("private key hex:")
+	fmt.Println("0x" + skHex)
+	return nil
+}
+
+// loadPrivateKey loads both shares and reconstructs the private key, once
+// the shares passed every check and co-signed a test hash. With a path, the
+// shares are shifted to that child first, and only its key is put together.
+func loadPrivateKey(userShare, backupShare *shareInput, overrides *walletOverrides, path []uint32) (curve.Scalar, *walletPair, error) {
+	pair, err := loadWalletPair(userShare, backupShare, overrides)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pair, err = pair.deriveChild(path); err != nil {
+		return nil, nil, err
+	}
+
+	sk, err := reconstructKey(pair.user, pair.backup, pair.backupWalletId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := testCosign(pair.user, pair.backup, pair.userKey); err != nil {
+		return nil, nil, &keyCheckError{"co-signing", err.Error()}
+	}
+	fmt.Fprintln(os.Stderr, "the user share and the backup share co-signed a random test hash")
+	return sk, pair, nil
+}
+
+// exportKeystore writes the private key to a keystore encrypted with a
+// passphrase asked for on the terminal.
+func exportKeystore(skBytes []byte, out *exportOutput) error {
+	key, err := crypto.ToECDSA(skBytes)
+	if err != nil {
+		return err
+	}
+	passphrase, err := promptPassphrase("encrypt the keystore with")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "encrypting with %s, this takes a moment\n", out.kdf)
+	path, err := writeKeystore(out.dir, key, passphrase, out.kdf)
+	if err != nil {
+		return fmt.Errorf("writing the keystore: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, "the keystore was read back and decrypts to the exported key")
+
+	fmt.Println("address:")
+	fmt.Println(crypto.PubkeyToAddress(key.PublicKey).Hex())
+	fmt.Println("keystore file:")
+	fmt.Println(path)
+	return nil
+}
+
+// walletPair holds the two halves of a DKLS wallet.
+type walletPair struct {
+	user, backup *mpcsigner.DKLSSigner
+	userKey      *dklsShare
+	// backupWalletId is the wallet ID the backup share records, if any.
+	backupWalletId string
+}
+
+// loadWalletPair loads the user share and the Capsule backup share and
+// builds the signers of both halves of the wallet. Shares without a
+// configured source are prompted for on the terminal.
+func loadWalletPair(userShare, backupShare *shareInput, overrides *walletOverrides) (*walletPair, error) {
+	user, err := loadUserShare(userShare)
+	if err != nil {
+		return nil, err
+	}
+	if err := overrides.apply(user); err != nil {
+		return nil, err
+	}
+	userSigner, err := user.dklsUserSigner()
+	if err != nil {
+		return nil, err
+	}
+	userKey, err := signerShare(userSigner)
+	if err != nil {
+		return nil, err
+	}
+
+	if !userShare.isSet() || !backupShare.isSet() {
+		if err := confirmWallet(userSigner); err != nil {
+			return nil, err
+		}
+	}
+
+	backup, err := loadBackupShare(backupShare)
+	if err != nil {
+		return nil, err
+	}
+	capsuleShareConfig, err := backup.backupConfig(userKey.isReceiver)
+	if err != nil {
+		return nil, err
+	}
+
+	capsuleSigner, err := deserializeCapsuleShare(user.dklsParams, userKey, capsuleShareConfig)
+	if err != nil {
+		diagnoseBackupKey(capsuleShareConfig, userKey).print(os.Stderr)
+		return nil, err
+	}
+	return &walletPair{
+		user:           userSigner,
+		backup:         capsuleSigner,
+		userKey:        userKey,
+		backupWalletId: overrides.backupWalletId(backup),
+	}, nil
+}
+
+// deserializeCapsuleShare builds the Capsule backup signer for the user's
+// wallet from the config copied out of the backup kit, repairing characters
+// that were mangled on the way out of the pdf. The backup signer takes the
+// role the user share doesn't hold.
+func deserializeCapsuleShare(userParams *mpcsigner.DKLSSerializableSigner, userKey *dklsShare, capsuleShareConfig string) (*mpcsigner.DKLSSigner, error) {
+	cleanCapsuleShareConfig, fixes, err := repairBackupKey(capsuleShareConfig, userKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, fix := range fixes {
+		fmt.Fprintf(os.Stderr, "repaired backup key at %s\n", fix)
+	}
+
+	if _, err := decodeShareConfig(cleanCapsuleShareConfig, !userKey.isReceiver); err != nil {
+		return nil, fmt.Errorf("the backup key doesn't decode to a %s config: %w", roleName(!userKey.isReceiver), err)
+	}
+
+	capsuleShare, err := json.Marshal(counterpartParams(userParams, cleanCapsuleShareConfig))
+	if err != nil {
+		return nil, err
+	}
+	return mpcsigner.DKLSDeserializeSigner(string(capsuleShare), "")
+}
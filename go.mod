@@ -2,23 +2,27 @@ module github.com/capsule-org/mpc-export-internal
 
 go 1.22.5
 
-require github.com/capsule-org/go-sdk v0.25.0
+require (
+	github.com/capsule-org/go-sdk v0.25.0
+	github.com/capsule-org/multi-party-sig v0.0.2-0.20240124180317-3ef16283509b
+	github.com/ethereum/go-ethereum v1.14.7
+	github.com/fxamacker/cbor/v2 v2.5.0
+	github.com/klauspost/compress v1.16.0
+	golang.org/x/crypto v0.32.0
+	golang.org/x/sys v0.29.0
+)
 
 require (
 	filippo.io/edwards25519 v1.0.0-rc.1 // indirect
 	github.com/bits-and-blooms/bitset v1.13.0 // indirect
 	github.com/btcsuite/btcd/btcec/v2 v2.3.3 // indirect
-	github.com/capsule-org/multi-party-sig v0.0.2-0.20240124180317-3ef16283509b // indirect
 	github.com/consensys/bavard v0.1.13 // indirect
 	github.com/consensys/gnark-crypto v0.12.1 // indirect
 	github.com/crate-crypto/go-kzg-4844 v1.0.0 // indirect
 	github.com/cronokirby/saferith v0.33.0 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.3.0 // indirect
 	github.com/ethereum/c-kzg-4844 v1.0.0 // indirect
-	github.com/ethereum/go-ethereum v1.14.7 // indirect
-	github.com/fxamacker/cbor/v2 v2.5.0 // indirect
 	github.com/holiman/uint256 v1.3.0 // indirect
-	github.com/klauspost/compress v1.16.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.5 // indirect
 	github.com/mmcloughlin/addchain v0.4.0 // indirect
 	github.com/mr-tron/base58 v1.2.0 // indirect
@@ -27,9 +31,7 @@ require (
 	github.com/wealdtech/go-merkletree v1.0.0 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
 	github.com/zeebo/blake3 v0.2.3 // indirect
-	golang.org/x/crypto v0.32.0 // indirect
 	golang.org/x/sync v0.8.0 // indirect
-	golang.org/x/sys v0.29.0 // indirect
 	nhooyr.io/websocket v1.8.7 // indirect
 	rsc.io/tmplfunc v0.0.3 // indirect
 )
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxShareInputSize bounds how much is read from a single share input.
+const maxShareInputSize = 16 << 20
+
+// shareInput is a secret input that is read from a file, stdin or an inherited
+// file descriptor rather than from argv, so it never shows up in shell history
+// or /proc/<pid>/cmdline.
+type shareInput struct {
+	label string
+	file  string
+	fd    fdFlag
+}
+
+// fdFlag is a file descriptor flag that distinguishes "not given" from 0.
+type fdFlag struct {
+	n   int
+	set bool
+}
+
+func (f *fdFlag) String() string {
+	if !f.set {
+		return ""
+	}
+	return strconv.Itoa(f.n)
+}
+
+func (f *fdFlag) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid file descriptor %q", s)
+	}
+	f.n, f.set = n, true
+	return nil
+}
+
+// register adds the --<name>-file and --<name>-fd flags for this input.
+func (in *shareInput) register(fs *flag.FlagSet, name, label string) {
+	in.label = label
+	fs.StringVar(&in.file, name+"-file", "", "read the "+label+" from `path` (\"-\" for stdin)")
+	fs.Var(&in.fd, name+"-fd", "read the "+label+" from the already open file descriptor `n`")
+}
+
+// isSet reports whether a source was given for this input.
+func (in *shareInput) isSet() bool {
+	return in.file != "" || in.fd.set
+}
+
+// usesStdin reports whether this input is read from stdin.
+func (in *shareInput) usesStdin() bool {
+	return in.file == "-" || (in.fd.set && in.fd.n == 0)
+}
+
+// readBytes returns the unmodified contents of the input.
+func (in *shareInput) readBytes() ([]byte, error) {
+	if in.file != "" && in.fd.set {
+		return nil, usageErrorf("the %s can be read from a file or a file descriptor, not both", in.label)
+	}
+
+	var r io.Reader
+	switch {
+	case in.usesStdin():
+		r = os.Stdin
+	case in.file != "":
+		f, err := os.Open(in.file)
+		if err != nil {
+			return nil, fmt.Errorf("opening %s: %w", in.label, err)
+		}
+		defer f.Close()
+		r = f
+	case in.fd.set:
+		f := os.NewFile(uintptr(in.fd.n), fmt.Sprintf("fd %d", in.fd.n))
+		if f == nil {
+			return nil, fmt.Errorf("invalid file descriptor %d for %s", in.fd.n, in.label)
+		}
+		defer f.Close()
+		r = f
+	default:
+		return nil, usageErrorf("no source given for the %s", in.label)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxShareInputSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", in.label, err)
+	}
+	if len(data) > maxShareInputSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", in.label, maxShareInputSize)
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, errors.New(in.label + " is empty")
+	}
+	return data, nil
+}
+
+// checkStdin rejects invocations where more than one input wants stdin.
+func checkStdin(inputs ...*shareInput) error {
+	n := 0
+	for _, in := range inputs {
+		if in.usesStdin() {
+			n++
+		}
+	}
+	if n > 1 {
+		return usageErrorf("only one input can be read from stdin")
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// fingerprintDomain separates share fingerprints from any other hash of the
+// same bytes.
+const fingerprintDomain = "mpc-export share fingerprint v1\x00"
+
+var inspectCommand = &command{
+	name:    "inspect",
+	summary: "Show which wallet a user share or backup key belongs to, without printing any secret material.\n\nThe share can be given in any of the formats export accepts. Its fingerprint is a one-way hash of the share's config, the same for every format the share comes in, and tells shares of the same wallet apart.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var share shareInput
+		share.register(fs, "share", "share")
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -share-* flags")
+			}
+			data, err := share.readOrPrompt()
+			if err != nil {
+				return err
+			}
+			loaded, err := classifyShare(data, true)
+			if err != nil {
+				return err
+			}
+			return inspectShare(os.Stdout, loaded)
+		}
+	},
+}
+
+// inspectShare prints the public metadata of a share.
+func inspectShare(w io.Writer, share *loadedShare) error {
+	fmt.Fprintf(w, "format:       %s\n", share.describe())
+
+	var config string
+	var isReceiver bool
+	switch {
+	case share.dkls != nil:
+		p := share.dklsParams
+		fmt.Fprintf(w, "wallet ID:    %s\n", p.WalletId)
+		fmt.Fprintf(w, "party ID:     %s\n", p.Id)
+		fmt.Fprintf(w, "other ID:     %s\n", p.OtherId)
+		config, isReceiver = p.SenderConfig, p.IsReceiver
+		if isReceiver {
+			config = p.ReceiverConfig
+		}
+	case share.backupKey != "":
+		config = share.backupKey
+		if _, err := decodeReceiverConfig(config); err == nil {
+			isReceiver = true
+		} else if _, err := decodeSenderConfig(config); err != nil {
+			return errors.New("the backup key doesn't decode, run the diagnose command to find the damage")
+		}
+		fmt.Fprintln(w, "wallet ID:    not recorded in a backup key")
+	case share.cmp != nil:
+		fmt.Fprintf(w, "wallet ID:    %s\n", share.cmp.GetWalletId())
+		fmt.Fprintf(w, "party ID:     %s\n", share.cmp.GetPartyId())
+		fmt.Fprintf(w, "party IDs:    %v\n", share.cmp.GetPartyIds())
+		fmt.Fprintf(w, "threshold:    %d\n", share.cmp.GetThreshold())
+		fmt.Fprintf(w, "public key:   %s\n", share.cmp.GetPublicKey())
+		return nil
+	case share.ed25519 != nil:
+		fmt.Fprintf(w, "wallet ID:    %s\n", share.ed25519.WalletId)
+		fmt.Fprintf(w, "party ID:     %s\n", share.ed25519.Id)
+		fmt.Fprintf(w, "other ID:     %s\n", share.ed25519.OtherId)
+		fmt.Fprintf(w, "address:      %s\n", share.ed25519.GetAddress())
+		return nil
+	}
+
+	key, err := decodeShareConfig(config, isReceiver)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "role:         %s (isReceiver %t)\n", roleName(isReceiver), isReceiver)
+
+	forms, err := encodePublicKey(key.public)
+	if err != nil {
+		return err
+	}
+	address, err := ethereumAddress(key.public)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "public key:")
+	fmt.Fprintf(w, "  compressed:   0x%x\n", forms.compressed)
+	fmt.Fprintf(w, "  uncompressed: 0x%x\n", forms.uncompressed)
+	fmt.Fprintf(w, "  x-only:       0x%x\n", forms.xOnly)
+	fmt.Fprintf(w, "address:      %s\n", address.Hex())
+
+	if len(key.chainKey) > 0 {
+		fmt.Fprintf(w, "chain key:    present (%d bytes)\n", len(key.chainKey))
+	} else {
+		fmt.Fprintln(w, "chain key:    absent")
+	}
+
+	setupSize, err := configSetupSize(config)
+	if err != nil {
+		return err
+	}
+	setupType := "CorreOTSendSetup"
+	if isReceiver {
+		setupType = "CorreOTReceiveSetup"
+	}
+	fmt.Fprintf(w, "OT setup:     %s, %d bytes\n", setupType, setupSize)
+
+	fingerprint, err := shareFingerprint(config)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "fingerprint:  %s\n", fingerprint)
+	return nil
+}
+
+// configSetupSize returns the length of the encoded OT setup of a config, as
+// stored in its cbor.
+func configSetupSize(config string) (int, error) {
+	raw, err := base64.StdEncoding.DecodeString(config)
+	if err != nil {
+		return 0, err
+	}
+	var fields struct {
+		Setup []byte
+	}
+	if err := cbor.Unmarshal(raw, &fields); err != nil {
+		return 0, err
+	}
+	return len(fields.Setup), nil
+}
+
+// shareFingerprint hashes the cbor encoding of a config, which stays the same
+// whatever format the share is wrapped in.
+func shareFingerprint(config string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(config)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(fingerprintDomain))
+	h.Write(raw)
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KDF parameters of the keystores written, the ones geth uses by default.
+const (
+	keystoreScryptN   = 1 << 18
+	keystoreScryptR   = 8
+	keystoreScryptP   = 1
+	keystorePBKDF2C   = 1 << 18
+	keystoreKeyLength = 32
+)
+
+// keystoreFile is a Web3 Secret Storage (version 3) key file.
+type keystoreFile struct {
+	Address string         `json:"address"`
+	Crypto  keystoreCrypto `json:"crypto"`
+	ID      string         `json:"id"`
+	Version int            `json:"version"`
+}
+
+type keystoreCrypto struct {
+	Cipher       string         `json:"cipher"`
+	CipherText   string         `json:"ciphertext"`
+	CipherParams keystoreIV     `json:"cipherparams"`
+	KDF          string         `json:"kdf"`
+	KDFParams    keystoreKDFArg `json:"kdfparams"`
+	MAC          string         `json:"mac"`
+}
+
+type keystoreIV struct {
+	IV string `json:"iv"`
+}
+
+// keystoreKDFArg holds the parameters of either KDF, scrypt's n, r and p
+// or pbkdf2's c and prf.
+type keystoreKDFArg struct {
+	DKLen int    `json:"dklen"`
+	N     int    `json:"n,omitempty"`
+	R     int    `json:"r,omitempty"`
+	P     int    `json:"p,omitempty"`
+	C     int    `json:"c,omitempty"`
+	PRF   string `json:"prf,omitempty"`
+	Salt  string `json:"salt"`
+}
+
+// derive runs the KDF named kdf over the passphrase.
+func (arg *keystoreKDFArg) derive(kdf, passphrase string) ([]byte, error) {
+	salt, err := hex.DecodeString(arg.Salt)
+	if err != nil {
+		return nil, errors.New("the salt is not hex")
+	}
+	if arg.DKLen < 32 {
+		return nil, fmt.Errorf("a derived key of %d bytes is too short", arg.DKLen)
+	}
+	switch kdf {
+	case "scrypt":
+		return scrypt.Key([]byte(passphrase), salt, arg.N, arg.R, arg.P, arg.DKLen)
+	case "pbkdf2":
+		if arg.PRF != "hmac-sha256" {
+			return nil, fmt.Errorf("pbkdf2 with %q is not supported", arg.PRF)
+		}
+		if arg.C <= 0 {
+			return nil, errors.New("the pbkdf2 iteration count is not positive")
+		}
+		return pbkdf2.Key([]byte(passphrase), salt, arg.C, arg.DKLen, sha256.New), nil
+	}
+	return nil, fmt.Errorf("kdf %q is not supported", kdf)
+}
+
+// encryptKeystore encrypts a private key into a keystore, the way geth does:
+// AES-128-CTR under the first half of the derived key, and a keccak256 MAC
+// over the second half and the ciphertext.
+func encryptKeystore(key *ecdsa.PrivateKey, passphrase, kdf string) (*keystoreFile, error) {
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	id := make([]byte, 16)
+	for _, b := range [][]byte{salt, iv, id} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+	}
+	// a version 4 UUID
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	arg := keystoreKDFArg{DKLen: keystoreKeyLength, Salt: hex.EncodeToString(salt)}
+	switch kdf {
+	case "scrypt":
+		arg.N, arg.R, arg.P = keystoreScryptN, keystoreScryptR, keystoreScryptP
+	case "pbkdf2":
+		arg.C, arg.PRF = keystorePBKDF2C, "hmac-sha256"
+	default:
+		return nil, fmt.Errorf("kdf %q is not supported", kdf)
+	}
+	dk, err := arg.derive(kdf, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := aesCTR(dk[:16], iv, crypto.FromECDSA(key))
+	if err != nil {
+		return nil, err
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	return &keystoreFile{
+		Address: hex.EncodeToString(address[:]),
+		Crypto: keystoreCrypto{
+			Cipher:       "aes-128-ctr",
+			CipherText:   hex.EncodeToString(ciphertext),
+			CipherParams: keystoreIV{hex.EncodeToString(iv)},
+			KDF:          kdf,
+			KDFParams:    arg,
+			MAC:          hex.EncodeToString(crypto.Keccak256(dk[16:32], ciphertext)),
+		},
+		ID:      fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]),
+		Version: 3,
+	}, nil
+}
+
+// decryptKeystore checks the MAC of a keystore and decrypts its key.
+func decryptKeystore(ks *keystoreFile, passphrase string) (*ecdsa.PrivateKey, error) {
+	if ks.Version != 3 {
+		return nil, fmt.Errorf("keystore version %d is not supported", ks.Version)
+	}
+	if ks.Crypto.Cipher != "aes-128-ctr" {
+		return nil, fmt.Errorf("cipher %q is not supported", ks.Crypto.Cipher)
+	}
+	ciphertext, err := hex.DecodeString(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, errors.New("the ciphertext is not hex")
+	}
+	iv, err := hex.DecodeString(ks.Crypto.CipherParams.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("the IV is not 16 bytes of hex")
+	}
+	mac, err := hex.DecodeString(ks.Crypto.MAC)
+	if err != nil {
+		return nil, errors.New("the MAC is not hex")
+	}
+
+	dk, err := ks.Crypto.KDFParams.derive(ks.Crypto.KDF, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(crypto.Keccak256(dk[16:32], ciphertext), mac) {
+		return nil, errors.New("the MAC doesn't match, the passphrase is wrong or the file is damaged")
+	}
+	plaintext, err := aesCTR(dk[:16], iv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.ToECDSA(plaintext)
+}
+
+func aesCTR(key, iv, in []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(in))
+	cipher.NewCTR(block, iv).XORKeyStream(out, in)
+	return out, nil
+}
+
+// keystoreFileName is the name geth gives the key file of an address.
+func keystoreFileName(t time.Time, address common.Address) string {
+	t = t.UTC()
+	return fmt.Sprintf("UTC--%04d-%02d-%02dT%02d-%02d-%02d.%09dZ--%x",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), address[:])
+}
+
+// writeKeystore encrypts the key into a new key file in dir, then reads the
+// file back and decrypts it to make sure it holds the key. The file is
+// removed if it doesn't.
+func writeKeystore(dir string, key *ecdsa.PrivateKey, passphrase, kdf string) (string, error) {
+	ks, err := encryptKeystore(key, passphrase, kdf)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(ks)
+	if err != nil {
+		return "", err
+	}
+
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	path := filepath.Join(dir, keystoreFileName(time.Now(), address))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = checkKeystore(path, key, passphrase)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// checkKeystore decrypts a key file written to disk and compares it with the
+// key it should hold.
+func checkKeystore(path string, key *ecdsa.PrivateKey, passphrase string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var ks keystoreFile
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return fmt.Errorf("the keystore written doesn't parse: %w", err)
+	}
+	decrypted, err := decryptKeystore(&ks, passphrase)
+	if err != nil {
+		return fmt.Errorf("the keystore written doesn't decrypt: %w", err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	if !decrypted.Equal(key) || ks.Address != hex.EncodeToString(address[:]) {
+		return errors.New("the keystore written doesn't hold the exported key")
+	}
+	return nil
+}
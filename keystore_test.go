@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The test vectors of the Web3 Secret Storage definition, both for the
+// passphrase "testpassword".
+var keystoreVectors = map[string]keystoreCrypto{
+	"pbkdf2": {
+		Cipher:       "aes-128-ctr",
+		CipherText:   "5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46",
+		CipherParams: keystoreIV{IV: "6087dab2f9fdbbfaddc31a909735c1e6"},
+		KDF:          "pbkdf2",
+		KDFParams:    keystoreKDFArg{DKLen: 32, C: 262144, PRF: "hmac-sha256", Salt: "ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"},
+		MAC:          "517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2",
+	},
+	"scrypt": {
+		Cipher:       "aes-128-ctr",
+		CipherText:   "d172bf743a674da9cdad04534d56926ef8358534d458fffccd4e6ad2fbde479c",
+		CipherParams: keystoreIV{IV: "83dbcc02d8ccb40e466191a123791e0e"},
+		KDF:          "scrypt",
+		KDFParams:    keystoreKDFArg{DKLen: 32, N: 262144, R: 1, P: 8, Salt: "ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"},
+		MAC:          "2103ac29920d71da29f15d75b4a16dbe95cfd7ff8faea1056c33131d846e3097",
+	},
+}
+
+func TestDecryptKeystoreVectors(t *testing.T) {
+	const want = "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d"
+	for kdf, c := range keystoreVectors {
+		key, err := decryptKeystore(&keystoreFile{Crypto: c, Version: 3}, "testpassword")
+		if err != nil {
+			t.Errorf("%s: %v", kdf, err)
+			continue
+		}
+		if got := hex.EncodeToString(crypto.FromECDSA(key)); got != want {
+			t.Errorf("%s: decrypted %s, want %s", kdf, got, want)
+		}
+		if _, err := decryptKeystore(&keystoreFile{Crypto: c, Version: 3}, "wrong"); err == nil {
+			t.Errorf("%s: decrypted with the wrong passphrase", kdf)
+		}
+	}
+}
@@ -1,81 +1,150 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
 	"strings"
+)
 
-	mpcsigner "github.com/capsule-org/go-sdk/signer"
+// Exit codes shared by every command.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
 )
 
+// command is a single subcommand of the tool.
+type command struct {
+	name    string
+	args    string
+	summary string
+	// setup registers the command's flags and returns the function that runs it
+	// once the flags have been parsed.
+	setup func(fs *flag.FlagSet) func(args []string) error
+}
+
+var commands = []*command{
+	exportCommand,
+	diagnoseCommand,
+	verifyPairCommand,
+	inspectCommand,
+	checkCommand,
+	signCommand,
+	signTxCommand,
+	signMessageCommand,
+	signTypedDataCommand,
+	verifyCommand,
+	sweepCommand,
+	xprvCommand,
+	xpubCommand,
+}
+
+// usageError marks errors caused by invalid invocation rather than bad input data.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, a ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, a...)}
+}
+
 func main() {
-	fmt.Println("\n\n---------------- Generating private key with backup share ----------------\n")
-	userShare := os.Args[1]
-	capsuleShareConfig := os.Args[2]
-
-	// if userShare is the snaps recovery secret, extract the share from everything after the "|" character
-	if strings.Contains(userShare, "|") {
-		splitUserShare := strings.SplitN(userShare, "|", 2)
-		decodedUserShare, err := base64.RawStdEncoding.DecodeString(splitUserShare[1])
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
+	os.Exit(run(os.Args[1:]))
+}
 
-		userShare = string(decodedUserShare)
+func run(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return exitUsage
 	}
 
-	userSigner, err := mpcsigner.DKLSDeserializeSigner(userShare, "")
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		if len(args) > 1 {
+			if cmd := findCommand(args[1]); cmd != nil {
+				fs := newFlagSet(cmd)
+				cmd.setup(fs)
+				fs.SetOutput(os.Stdout)
+				fs.Usage()
+				return exitOK
+			}
+		}
+		printUsage(os.Stdout)
+		return exitOK
 	}
 
-	// regex to replace non base64 characters with "ff" as it's encoded incorrectly in the pdf
-	reg, err := regexp.Compile("[^A-Za-z0-9+/=]+")
-	if err != nil {
-		fmt.Println("error compiling regex:", err)
-		os.Exit(1)
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return exitUsage
 	}
 
-	cleanCapsuleShareConfig := reg.ReplaceAllString(
-		strings.ReplaceAll(capsuleShareConfig, " ", ""),
-		"ff",
-	)
-
-	capsuleShare := fmt.Sprintf(
-		`{"walletId":"%s","id":"%s","otherId":"%s","receiverConfig":"%s","senderConfig":"%s","isReceiver":%t,"disableWebSockets":%t}`,
-		userSigner.GetWalletId(),
-		"CAPSULE",
-		"USER",
-		cleanCapsuleShareConfig,
-		"9g==",
-		true,
-		false,
-	)
-
-	capsuleSigner, err := mpcsigner.DKLSDeserializeSigner(capsuleShare, "")
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	fs := newFlagSet(cmd)
+	runCmd := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
 	}
 
-	sk1 := userSigner.GetPrivateKey()
-	sk2 := capsuleSigner.GetPrivateKey()
-
-	sk := sk1.Add(sk2)
+	if err := runCmd(fs.Args()); err != nil {
+		var uerr *usageError
+		if errors.As(err, &uerr) {
+			fmt.Fprintf(os.Stderr, "%s: %s\n\n", cmd.name, uerr.msg)
+			fs.Usage()
+			return exitUsage
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", cmd.name, err)
+		return exitFailure
+	}
+	return exitOK
+}
 
-	skBytes, err := sk.MarshalBinary()
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
 	}
+	return nil
+}
 
-	skHex := hex.EncodeToString(skBytes)
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: %s\n\n%s\n", strings.TrimSpace("mpc-export "+cmd.name+" [flags] "+cmd.args), cmd.summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(out, "\nflags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
 
-	fmt.Println("private key hex:")
-	fmt.Println("0x" + skHex)
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: mpc-export <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.name))
+	}
+	for _, cmd := range commands {
+		summary, _, _ := strings.Cut(cmd.summary, "\n")
+		fmt.Fprintf(w, "  %-*s  %s\n", width, cmd.name, summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `run "mpc-export help <command>" for details on a command`)
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var signMessageCommand = &command{
+	name:    "sign-message",
+	summary: "Sign a message the way personal_sign does (EIP-191).\n\nThe message is given as UTF-8 text, as hex, or read from a file as it is. It's prefixed with \"\\x19Ethereum Signed Message:\\n\" and its length before it's hashed and signed. The 65-byte signature is printed with v 27 or 28, once it recovers to the wallet's address.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var signing signingInputs
+		var msg messageInput
+		signing.register(fs)
+		msg.register(fs)
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -user-share-* and -backup-share-* flags")
+			}
+			if err := checkStdin(append(signing.inputs(), &msg.file)...); err != nil {
+				return err
+			}
+			message, err := msg.read()
+			if err != nil {
+				return err
+			}
+			s, err := signing.load()
+			if err != nil {
+				return err
+			}
+			return signDigest(s, personalMessageHash(message))
+		}
+	},
+}
+
+var signTypedDataCommand = &command{
+	name:    "sign-typed-data",
+	summary: "Sign EIP-712 typed data the way eth_signTypedData_v4 does.\n\nThe typed data is read from a JSON document with types, primaryType, domain and message. The domain separator, the message hash and the digest are printed, so they can be compared with what a hardware wallet or a Safe shows, and the domain and primary type are shown and only signed once confirmed. The 65-byte signature is printed with v 27 or 28, once it recovers to the wallet's address.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var signing signingInputs
+		var typedInput shareInput
+		var yes bool
+		signing.register(fs)
+		typedInput.register(fs, "typed-data", "EIP-712 typed data")
+		fs.BoolVar(&yes, "yes", false, "sign without asking for confirmation after the typed data is shown")
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -user-share-* and -backup-share-* flags")
+			}
+			if !typedInput.isSet() {
+				return usageErrorf("no typed data given, use -typed-data-file or -typed-data-fd")
+			}
+			if err := checkStdin(append(signing.inputs(), &typedInput)...); err != nil {
+				return err
+			}
+			data, err := typedInput.readBytes()
+			if err != nil {
+				return err
+			}
+			td, err := parseTypedData(data)
+			if err != nil {
+				return err
+			}
+			domainSeparator, messageHash, digest, err := td.hashes()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("primary type:     %s\n", td.PrimaryType)
+			fmt.Printf("domain separator: 0x%x\n", domainSeparator)
+			if messageHash != nil {
+				fmt.Printf("message hash:     0x%x\n", messageHash)
+			}
+			previewTypedData(os.Stderr, td)
+			if !yes {
+				if err := confirmOnTerminal("Sign this typed data?", "the typed data was not signed"); err != nil {
+					return err
+				}
+			}
+
+			s, err := signing.load()
+			if err != nil {
+				return err
+			}
+			return signDigest(s, digest)
+		}
+	},
+}
+
+// messageInput is a message given as text or hex on the command line, or
+// read from a file.
+type messageInput struct {
+	text, hex string
+	file      shareInput
+}
+
+func (in *messageInput) register(fs *flag.FlagSet) {
+	fs.StringVar(&in.text, "message", "", "use the UTF-8 `text` as the message")
+	fs.StringVar(&in.hex, "message-hex", "", "use the bytes given as `hex` as the message")
+	in.file.register(fs, "message", "message")
+}
+
+// given returns in how many ways the message was given.
+func (in *messageInput) given() int {
+	n := 0
+	for _, set := range []bool{in.text != "", in.hex != "", in.file.isSet()} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+func (in *messageInput) read() ([]byte, error) {
+	switch given := in.given(); {
+	case given == 0:
+		return nil, usageErrorf("no message given, use -message, -message-hex, -message-file or -message-fd")
+	case given > 1:
+		return nil, usageErrorf("give the message in only one way")
+	case in.text != "":
+		return []byte(in.text), nil
+	case in.hex != "":
+		b, err := decodeHex(in.hex)
+		if err != nil {
+			return nil, usageErrorf("-message-hex is not valid hex")
+		}
+		return b, nil
+	}
+	return in.file.readBytes()
+}
+
+// personalMessageHash is the EIP-191 version 0x45 hash of a message, as
+// signed by personal_sign.
+func personalMessageHash(message []byte) []byte {
+	prefix := "\x19Ethereum Signed Message:\n" + strconv.Itoa(len(message))
+	return crypto.Keccak256([]byte(prefix), message)
+}
+
+// signDigest signs a message digest and prints the signature with v 27 or
+// 28, after recovering the signer from it.
+func signDigest(s hashSigner, digest []byte) error {
+	sig, err := s.signHash(digest)
+	if err != nil {
+		return err
+	}
+	sig[64] += 27
+
+	want, err := s.address()
+	if err != nil {
+		return err
+	}
+	if err := checkRecovery(digest, sig, want); err != nil {
+		return err
+	}
+
+	fmt.Printf("digest:           0x%x\n", digest)
+	fmt.Printf("signer:           %s\n", want.Hex())
+	fmt.Println("signature hex:")
+	fmt.Println("0x" + hex.EncodeToString(sig))
+	return nil
+}
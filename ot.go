@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Dimensions of the correlated OT setups created during DKLS key generation.
+const (
+	otParam = 128
+	otBytes = otParam / 8
+)
+
+type otMatrix [otParam][otBytes]byte
+
+// otSendSetup holds the contents of a sender's CorreOTSendSetup. The setup's
+// fields are unexported, so they're read back from its binary encoding.
+type otSendSetup struct {
+	delta  [otBytes]byte
+	kDelta otMatrix
+}
+
+// otReceiveSetup holds the contents of a receiver's CorreOTReceiveSetup.
+type otReceiveSetup struct {
+	k0, k1 otMatrix
+}
+
+func decodeOTSendSetup(setup encoding.BinaryMarshaler) (*otSendSetup, error) {
+	if setup == nil {
+		return nil, errors.New("sender has no OT setup")
+	}
+	data, err := setup.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < otBytes {
+		return nil, fmt.Errorf("sender OT setup is %d bytes long", len(data))
+	}
+
+	s := new(otSendSetup)
+	copy(s.delta[:], data[:otBytes])
+	if err := cbor.Unmarshal(data[otBytes:], &s.kDelta); err != nil {
+		return nil, fmt.Errorf("sender OT setup: %w", err)
+	}
+	return s, nil
+}
+
+func decodeOTReceiveSetup(setup encoding.BinaryMarshaler) (*otReceiveSetup, error) {
+	if setup == nil {
+		return nil, errors.New("receiver has no OT setup")
+	}
+	data, err := setup.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("receiver OT setup has an odd length of %d bytes", len(data))
+	}
+
+	s := new(otReceiveSetup)
+	half := len(data) / 2
+	if err := cbor.Unmarshal(data[:half], &s.k0); err != nil {
+		return nil, fmt.Errorf("receiver OT setup: %w", err)
+	}
+	if err := cbor.Unmarshal(data[half:], &s.k1); err != nil {
+		return nil, fmt.Errorf("receiver OT setup: %w", err)
+	}
+	return s, nil
+}
+
+// deltaBit returns the ith choice bit of the sender's correlation, in the
+// same order as the OT implementation: LSB first within each byte.
+func (s *otSendSetup) deltaBit(i int) byte {
+	return (s.delta[i>>3] >> (i & 7)) & 1
+}
+
+// otSetupsMatch checks that the sender's columns are the receiver's columns
+// picked by the sender's choice bits, which holds for any pair of setups that
+// came out of the same key generation or refresh.
+func otSetupsMatch(send *otSendSetup, recv *otReceiveSetup) error {
+	for i := 0; i < otParam; i++ {
+		want := recv.k0[i]
+		if send.deltaBit(i) == 1 {
+			want = recv.k1[i]
+		}
+		if send.kDelta[i] != want {
+			return fmt.Errorf("OT setups disagree at column %d", i)
+		}
+	}
+	return nil
+}
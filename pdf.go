@@ -0,0 +1,964 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// This file implements just enough of a PDF reader to pull the text out of
+// CapsuleBackupShare.pdf: objects are located by scanning for "N G obj"
+// rather than trusting the xref table, Flate streams and object streams are
+// inflated, and text is decoded through each font's ToUnicode CMap.
+
+// pdfMaxDepth bounds the nesting of page trees and form XObjects.
+const pdfMaxDepth = 32
+
+type (
+	pdfName   string
+	pdfString []byte
+	pdfDict   map[pdfName]any
+	pdfArray  []any
+	pdfRef    struct{ num, gen int }
+	// pdfKeyword is a bare token, which in content streams is an operator.
+	pdfKeyword string
+)
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+type pdfDocument struct {
+	objects map[int]any
+}
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// isPDF reports whether data looks like a PDF file.
+func isPDF(data []byte) bool {
+	head := data[:min(len(data), 1024)]
+	return bytes.Contains(head, []byte("%PDF-"))
+}
+
+func parsePDF(data []byte) (*pdfDocument, error) {
+	doc := &pdfDocument{objects: map[int]any{}}
+
+	pos := 0
+	for {
+		loc := pdfObjHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		lx := &pdfLexer{data: data, pos: pos + loc[1]}
+		obj, err := lx.parseObject()
+		if err != nil {
+			// a false match inside binary data, keep scanning after it
+			pos += loc[1]
+			continue
+		}
+		if dict, ok := obj.(pdfDict); ok {
+			if stream, ok := lx.parseStreamBody(dict); ok {
+				obj = stream
+			}
+		}
+		doc.objects[num] = obj
+		pos = lx.pos
+	}
+	if len(doc.objects) == 0 {
+		return nil, errors.New("no objects found in pdf")
+	}
+
+	doc.expandObjectStreams()
+	return doc, nil
+}
+
+// expandObjectStreams adds the objects stored inside /Type /ObjStm streams.
+func (doc *pdfDocument) expandObjectStreams() {
+	var streams []*pdfStream
+	for _, obj := range doc.objects {
+		if s, ok := obj.(*pdfStream); ok && s.dict["Type"] == pdfName("ObjStm") {
+			streams = append(streams, s)
+		}
+	}
+
+	for _, s := range streams {
+		data, err := doc.decodeStream(s)
+		if err != nil {
+			continue
+		}
+		n, _ := doc.resolve(s.dict["N"]).(int)
+		first, _ := doc.resolve(s.dict["First"]).(int)
+		if first < 0 || first > len(data) {
+			continue
+		}
+
+		header := &pdfLexer{data: data[:first]}
+		for i := 0; i < n; i++ {
+			num, err1 := header.parseObject()
+			offset, err2 := header.parseObject()
+			objNum, ok1 := num.(int)
+			objOffset, ok2 := offset.(int)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 || objOffset < 0 || first+objOffset < first || first+objOffset > len(data) {
+				break
+			}
+			if _, exists := doc.objects[objNum]; exists {
+				continue
+			}
+			lx := &pdfLexer{data: data, pos: first + objOffset}
+			if obj, err := lx.parseObject(); err == nil {
+				doc.objects[objNum] = obj
+			}
+		}
+	}
+}
+
+// resolve follows indirect references.
+func (doc *pdfDocument) resolve(obj any) any {
+	for i := 0; i < pdfMaxDepth; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = doc.objects[ref.num]
+	}
+	return nil
+}
+
+func (doc *pdfDocument) dict(obj any) pdfDict {
+	switch v := doc.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// decodeStream returns the stream contents with its filters applied.
+func (doc *pdfDocument) decodeStream(s *pdfStream) ([]byte, error) {
+	var filters []any
+	switch f := doc.resolve(s.dict["Filter"]).(type) {
+	case nil:
+	case pdfName:
+		filters = []any{f}
+	case pdfArray:
+		filters = f
+	}
+
+	data := s.raw
+	for _, f := range filters {
+		switch doc.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			inflated, err := inflate(data)
+			if err != nil {
+				return nil, err
+			}
+			data = inflated
+		default:
+			return nil, fmt.Errorf("unsupported pdf stream filter %v", f)
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses a zlib stream. The adler32 trailer isn't checked, as
+// some pdf writers truncate it.
+func inflate(data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, errors.New("flate stream too short")
+	}
+	if data[0]&0x0f != 8 || (uint16(data[0])<<8|uint16(data[1]))%31 != 0 {
+		return nil, errors.New("flate stream without zlib header")
+	}
+	r := flate.NewReader(bytes.NewReader(data[2:]))
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return out, nil
+}
+
+// pages returns the page dictionaries in document order, with inherited
+// resources filled in.
+func (doc *pdfDocument) pages() []pdfDict {
+	var pages []pdfDict
+	var walk func(node pdfDict, resources any, depth int)
+	walk = func(node pdfDict, resources any, depth int) {
+		if node == nil || depth > pdfMaxDepth {
+			return
+		}
+		if r, ok := node["Resources"]; ok {
+			resources = r
+		}
+		if node["Type"] == pdfName("Page") {
+			page := pdfDict{}
+			for k, v := range node {
+				page[k] = v
+			}
+			page["Resources"] = resources
+			pages = append(pages, page)
+			return
+		}
+		kids, _ := doc.resolve(node["Kids"]).(pdfArray)
+		for _, kid := range kids {
+			walk(doc.dict(kid), resources, depth+1)
+		}
+	}
+
+	for _, num := range doc.sortedObjectNumbers() {
+		if d := doc.dict(doc.objects[num]); d != nil && d["Type"] == pdfName("Catalog") {
+			walk(doc.dict(d["Pages"]), nil, 0)
+			if len(pages) > 0 {
+				return pages
+			}
+		}
+	}
+
+	// no usable page tree, fall back to every page object in numbering order
+	for _, num := range doc.sortedObjectNumbers() {
+		if d := doc.dict(doc.objects[num]); d != nil && d["Type"] == pdfName("Page") {
+			pages = append(pages, d)
+		}
+	}
+	return pages
+}
+
+func (doc *pdfDocument) sortedObjectNumbers() []int {
+	nums := make([]int, 0, len(doc.objects))
+	for num := range doc.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// extractPDFText returns the text of every page, one line of text per line.
+func extractPDFText(data []byte) (string, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return "", err
+	}
+
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return "", errors.New("no pages found in pdf")
+	}
+
+	var out strings.Builder
+	for _, page := range pages {
+		var contents []byte
+		switch c := doc.resolve(page["Contents"]).(type) {
+		case *pdfStream:
+			contents, err = doc.decodeStream(c)
+			if err != nil {
+				return "", err
+			}
+		case pdfArray:
+			for _, part := range c {
+				s, ok := doc.resolve(part).(*pdfStream)
+				if !ok {
+					continue
+				}
+				data, err := doc.decodeStream(s)
+				if err != nil {
+					return "", err
+				}
+				contents = append(append(contents, data...), '\n')
+			}
+		}
+
+		tx := &pdfTextExtractor{doc: doc, out: &out, fonts: map[*pdfStream]*pdfCMap{}}
+		tx.run(contents, doc.dict(page["Resources"]), 0)
+		out.WriteByte('\n')
+	}
+	return out.String(), nil
+}
+
+type pdfTextExtractor struct {
+	doc   *pdfDocument
+	out   *strings.Builder
+	fonts map[*pdfStream]*pdfCMap
+	font  *pdfFont
+	lastY float64
+}
+
+// pdfFont decodes the strings shown with one font.
+type pdfFont struct {
+	cmap     *pdfCMap
+	twoByte  bool
+	encoding map[byte]string
+}
+
+func (tx *pdfTextExtractor) newline() {
+	s := tx.out.String()
+	if len(s) > 0 && s[len(s)-1] != '\n' {
+		tx.out.WriteByte('\n')
+	}
+}
+
+// run interprets a content stream, writing the text it shows.
+func (tx *pdfTextExtractor) run(contents []byte, resources pdfDict, depth int) {
+	if depth > pdfMaxDepth {
+		return
+	}
+	fonts := tx.doc.dict(resources["Font"])
+	xobjects := tx.doc.dict(resources["XObject"])
+
+	lx := &pdfLexer{data: contents}
+	var operands []any
+	for {
+		obj, err := lx.parseObject()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "BI":
+			lx.skipInlineImage()
+		case "BT":
+			tx.lastY = 0
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					tx.font = tx.loadFont(tx.doc.dict(fonts[name]))
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 && pdfNumber(operands[1]) != 0 {
+				tx.newline()
+			}
+		case "T*":
+			tx.newline()
+		case "Tm":
+			if len(operands) >= 6 {
+				y := pdfNumber(operands[5])
+				if y != tx.lastY {
+					tx.newline()
+				}
+				tx.lastY = y
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				tx.show(operands[len(operands)-1])
+			}
+		case "'", "\"":
+			tx.newline()
+			if len(operands) >= 1 {
+				tx.show(operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				if arr, ok := operands[len(operands)-1].(pdfArray); ok {
+					for _, el := range arr {
+						tx.show(el)
+					}
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 {
+				name, _ := operands[0].(pdfName)
+				form, ok := tx.doc.resolve(xobjects[name]).(*pdfStream)
+				if ok && form.dict["Subtype"] == pdfName("Form") {
+					if data, err := tx.doc.decodeStream(form); err == nil {
+						formResources := tx.doc.dict(form.dict["Resources"])
+						if formResources == nil {
+							formResources = resources
+						}
+						saved := tx.font
+						tx.run(data, formResources, depth+1)
+						tx.font = saved
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func (tx *pdfTextExtractor) loadFont(dict pdfDict) *pdfFont {
+	font := &pdfFont{}
+	if dict == nil {
+		return font
+	}
+	font.twoByte = dict["Subtype"] == pdfName("Type0")
+
+	if s, ok := tx.doc.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		cmap, cached := tx.fonts[s]
+		if !cached {
+			if data, err := tx.doc.decodeStream(s); err == nil {
+				cmap = parseCMap(data)
+			}
+			tx.fonts[s] = cmap
+		}
+		font.cmap = cmap
+	}
+
+	if enc := tx.doc.dict(dict["Encoding"]); enc != nil {
+		diffs, _ := tx.doc.resolve(enc["Differences"]).(pdfArray)
+		font.encoding = map[byte]string{}
+		code := 0
+		for _, d := range diffs {
+			switch v := tx.doc.resolve(d).(type) {
+			case int:
+				code = v
+			case pdfName:
+				if s, ok := glyphNames[string(v)]; ok && code < 256 {
+					font.encoding[byte(code)] = s
+				} else if len(v) == 1 && code < 256 {
+					font.encoding[byte(code)] = string(v)
+				}
+				code++
+			}
+		}
+	}
+	return font
+}
+
+func (tx *pdfTextExtractor) show(obj any) {
+	s, ok := obj.(pdfString)
+	if !ok {
+		return
+	}
+	font := tx.font
+	if font == nil {
+		font = &pdfFont{}
+	}
+
+	if font.cmap != nil && len(font.cmap.chars) > 0 {
+		tx.out.WriteString(font.cmap.decode(s, font.twoByte))
+		return
+	}
+	for _, b := range s {
+		if r, ok := font.encoding[b]; ok {
+			tx.out.WriteString(r)
+		} else {
+			tx.out.WriteRune(rune(b))
+		}
+	}
+}
+
+// pdfCMap is a parsed ToUnicode CMap.
+type pdfCMap struct {
+	// codeLengths lists the byte lengths of codes declared in the codespace ranges.
+	codeLengths []int
+	chars       map[string]string
+}
+
+func parseCMap(data []byte) *pdfCMap {
+	cmap := &pdfCMap{chars: map[string]string{}}
+	lx := &pdfLexer{data: data}
+	var operands []any
+	for {
+		obj, err := lx.parseObject()
+		if err != nil {
+			break
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, ok := operands[i].(pdfString); ok && len(lo) > 0 {
+					cmap.addCodeLength(len(lo))
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					cmap.chars[string(src)] = decodeUTF16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				start, end := codeValue(lo), codeValue(hi)
+				if end < start || end-start > 0xffff {
+					continue
+				}
+				for code := start; code <= end; code++ {
+					src := codeBytes(code, len(lo))
+					switch dst := operands[i+2].(type) {
+					case pdfString:
+						cmap.chars[string(src)] = decodeUTF16BE(incrementLast(dst, int(code-start)))
+					case pdfArray:
+						if int(code-start) < len(dst) {
+							if s, ok := dst[code-start].(pdfString); ok {
+								cmap.chars[string(src)] = decodeUTF16BE(s)
+							}
+						}
+					}
+				}
+			}
+		}
+		if strings.HasPrefix(string(op), "end") || strings.HasPrefix(string(op), "begin") {
+			operands = operands[:0]
+		}
+	}
+	return cmap
+}
+
+func (c *pdfCMap) addCodeLength(n int) {
+	for _, l := range c.codeLengths {
+		if l == n {
+			return
+		}
+	}
+	c.codeLengths = append(c.codeLengths, n)
+	sort.Ints(c.codeLengths)
+}
+
+// decode maps a shown string to unicode, trying the shortest declared code
+// length that has a mapping at each position.
+func (c *pdfCMap) decode(s []byte, twoByte bool) string {
+	lengths := c.codeLengths
+	if len(lengths) == 0 {
+		lengths = []int{1}
+		if twoByte {
+			lengths = []int{2}
+		}
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		matched := false
+		for _, n := range lengths {
+			if i+n > len(s) {
+				continue
+			}
+			if r, ok := c.chars[string(s[i:i+n])]; ok {
+				out.WriteString(r)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			n := lengths[0]
+			if n == 1 {
+				out.WriteRune(rune(s[i]))
+			} else {
+				out.WriteRune('�')
+			}
+			i += n
+		}
+	}
+	return out.String()
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+// incrementLast adds delta to the last UTF-16 unit of a bfrange destination,
+// carrying from its last byte into the one before.
+func incrementLast(dst pdfString, delta int) pdfString {
+	out := append(pdfString(nil), dst...)
+	if len(out) > 0 {
+		v := codeValue(out[max(0, len(out)-2):]) + uint32(delta)
+		copy(out[max(0, len(out)-2):], codeBytes(v, min(2, len(out))))
+	}
+	return out
+}
+
+func decodeUTF16BE(b []byte) string {
+	if len(b)%2 != 0 {
+		return string(b)
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+func pdfNumber(obj any) float64 {
+	switch v := obj.(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// glyphNames maps the glyph names used in /Differences arrays that can occur
+// in a backup key and aren't a single character already.
+var glyphNames = map[string]string{
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+	"plus": "+", "slash": "/", "equal": "=", "space": " ",
+	"ff": "ff", "fi": "fi", "fl": "fl", "ffi": "ffi", "ffl": "ffl",
+	"f_f": "ff", "f_i": "fi", "f_l": "fl", "f_f_i": "ffi", "f_f_l": "ffl",
+}
+
+// pdfLexer parses pdf objects and content stream tokens.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+var errPDFEOF = errors.New("unexpected end of pdf data")
+
+func isPDFWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (lx *pdfLexer) skipSpace() {
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		if c == '%' {
+			for lx.pos < len(lx.data) && lx.data[lx.pos] != '\n' && lx.data[lx.pos] != '\r' {
+				lx.pos++
+			}
+			continue
+		}
+		if !isPDFWhitespace(c) {
+			return
+		}
+		lx.pos++
+	}
+}
+
+func (lx *pdfLexer) regular() []byte {
+	start := lx.pos
+	for lx.pos < len(lx.data) && !isPDFWhitespace(lx.data[lx.pos]) && !isPDFDelimiter(lx.data[lx.pos]) {
+		lx.pos++
+	}
+	return lx.data[start:lx.pos]
+}
+
+func (lx *pdfLexer) parseObject() (any, error) {
+	lx.skipSpace()
+	if lx.pos >= len(lx.data) {
+		return nil, errPDFEOF
+	}
+
+	switch c := lx.data[lx.pos]; {
+	case c == '/':
+		lx.pos++
+		return pdfName(decodeNameEscapes(lx.regular())), nil
+	case c == '(':
+		return lx.parseLiteralString()
+	case c == '<' && lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == '<':
+		return lx.parseDict()
+	case c == '<':
+		return lx.parseHexString()
+	case c == '[':
+		lx.pos++
+		var arr pdfArray
+		for {
+			lx.skipSpace()
+			if lx.pos >= len(lx.data) {
+				return nil, errPDFEOF
+			}
+			if lx.data[lx.pos] == ']' {
+				lx.pos++
+				return arr, nil
+			}
+			obj, err := lx.parseObject()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, obj)
+		}
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		lx.pos++
+		return pdfKeyword(c), nil
+	}
+
+	tok := lx.regular()
+	if len(tok) == 0 {
+		return nil, fmt.Errorf("unexpected byte %q in pdf", lx.data[lx.pos])
+	}
+	if n, err := strconv.Atoi(string(tok)); err == nil {
+		return lx.maybeRef(n), nil
+	}
+	if f, err := strconv.ParseFloat(string(tok), 64); err == nil && !strings.ContainsAny(string(tok), "eEnN") {
+		return f, nil
+	}
+	switch string(tok) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(tok), nil
+}
+
+// maybeRef turns "num gen R" into a reference, and leaves the lexer after num
+// otherwise.
+func (lx *pdfLexer) maybeRef(num int) any {
+	save := lx.pos
+	lx.skipSpace()
+	gen, err := strconv.Atoi(string(lx.regular()))
+	if err == nil {
+		lx.skipSpace()
+		if string(lx.regular()) == "R" {
+			return pdfRef{num: num, gen: gen}
+		}
+	}
+	lx.pos = save
+	return num
+}
+
+func (lx *pdfLexer) parseDict() (any, error) {
+	lx.pos += 2
+	dict := pdfDict{}
+	for {
+		lx.skipSpace()
+		if lx.pos+1 < len(lx.data) && lx.data[lx.pos] == '>' && lx.data[lx.pos+1] == '>' {
+			lx.pos += 2
+			return dict, nil
+		}
+		key, err := lx.parseObject()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			return nil, fmt.Errorf("pdf dictionary key %v is not a name", key)
+		}
+		value, err := lx.parseObject()
+		if err != nil {
+			return nil, err
+		}
+		dict[name] = value
+	}
+}
+
+func (lx *pdfLexer) parseHexString() (any, error) {
+	lx.pos++
+	var digits []byte
+	for {
+		if lx.pos >= len(lx.data) {
+			return nil, errPDFEOF
+		}
+		c := lx.data[lx.pos]
+		lx.pos++
+		if c == '>' {
+			break
+		}
+		if isPDFWhitespace(c) {
+			continue
+		}
+		if _, ok := hexDigit(c); !ok {
+			return nil, fmt.Errorf("invalid hex digit %q in pdf string", c)
+		}
+		digits = append(digits, c)
+	}
+	if len(digits)%2 != 0 {
+		digits = append(digits, '0')
+	}
+	out := make(pdfString, len(digits)/2)
+	for i := range out {
+		hi, _ := hexDigit(digits[2*i])
+		lo, _ := hexDigit(digits[2*i+1])
+		out[i] = hi<<4 | lo
+	}
+	return out, nil
+}
+
+func (lx *pdfLexer) parseLiteralString() (any, error) {
+	lx.pos++
+	var out pdfString
+	depth := 1
+	for {
+		if lx.pos >= len(lx.data) {
+			return nil, errPDFEOF
+		}
+		c := lx.data[lx.pos]
+		lx.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out, nil
+			}
+		case '\\':
+			if lx.pos >= len(lx.data) {
+				return nil, errPDFEOF
+			}
+			e := lx.data[lx.pos]
+			lx.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if lx.pos < len(lx.data) && lx.data[lx.pos] == '\n' {
+					lx.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && lx.pos < len(lx.data) && lx.data[lx.pos] >= '0' && lx.data[lx.pos] <= '7'; i++ {
+						v = v*8 + int(lx.data[lx.pos]-'0')
+						lx.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+}
+
+// parseStreamBody reads the stream data following a dictionary, if any.
+func (lx *pdfLexer) parseStreamBody(dict pdfDict) (*pdfStream, bool) {
+	save := lx.pos
+	lx.skipSpace()
+	if !bytes.HasPrefix(lx.data[lx.pos:], []byte("stream")) {
+		lx.pos = save
+		return nil, false
+	}
+	lx.pos += len("stream")
+	if lx.pos < len(lx.data) && lx.data[lx.pos] == '\r' {
+		lx.pos++
+	}
+	if lx.pos < len(lx.data) && lx.data[lx.pos] == '\n' {
+		lx.pos++
+	}
+	start := lx.pos
+
+	// trust a direct /Length only if endstream follows it
+	if n, ok := dict["Length"].(int); ok && n >= 0 && start+n <= len(lx.data) {
+		rest := bytes.TrimLeft(lx.data[start+n:], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			lx.pos = len(lx.data) - len(rest) + len("endstream")
+			return &pdfStream{dict: dict, raw: lx.data[start : start+n]}, true
+		}
+	}
+
+	end := bytes.Index(lx.data[start:], []byte("endstream"))
+	if end < 0 {
+		lx.pos = len(lx.data)
+		return &pdfStream{dict: dict, raw: lx.data[start:]}, true
+	}
+	raw := lx.data[start : start+end]
+	lx.pos = start + end + len("endstream")
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	return &pdfStream{dict: dict, raw: raw}, true
+}
+
+// skipInlineImage moves past the data of an inline image, up to and
+// including its EI operator.
+func (lx *pdfLexer) skipInlineImage() {
+	idx := bytes.Index(lx.data[lx.pos:], []byte("ID"))
+	if idx < 0 {
+		lx.pos = len(lx.data)
+		return
+	}
+	lx.pos += idx + 2
+	for lx.pos < len(lx.data) {
+		idx := bytes.Index(lx.data[lx.pos:], []byte("EI"))
+		if idx < 0 {
+			lx.pos = len(lx.data)
+			return
+		}
+		at := lx.pos + idx
+		lx.pos = at + 2
+		if at > 0 && isPDFWhitespace(lx.data[at-1]) && (lx.pos == len(lx.data) || isPDFWhitespace(lx.data[lx.pos])) {
+			return
+		}
+	}
+}
+
+func decodeNameEscapes(b []byte) string {
+	if !bytes.ContainsRune(b, '#') {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) {
+			hi, ok1 := hexDigit(b[i+1])
+			lo, ok2 := hexDigit(b[i+2])
+			if ok1 && ok2 {
+				out = append(out, hi<<4|lo)
+				i += 2
+				continue
+			}
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "pdf", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestExtractPDFText(t *testing.T) {
+	tests := []struct {
+		file, want string
+	}{
+		// an uncompressed content stream
+		{"plain.pdf", "Capsule Backup Key\npGVTZXR1cFk+/9=\n"},
+		// the same page with its content stream Flate compressed
+		{"flate.pdf", "Capsule Backup Key\npGVTZXR1cFk+/9=\n"},
+		// the page tree, page and font stored in a compressed object stream
+		{"objstm.pdf", "Capsule Backup Key\npGVTZXR1cFk+/9=\n"},
+		// two-byte glyph ids mapped by a ToUnicode CMap, with a bfrange, a
+		// bfrange array holding a ligature and a lookalike bfchar
+		{"type0.pdf", "Capsule Backup Key\npGVTfZﬀXА\n"},
+		// a Differences encoding naming ligatures and punctuation
+		{"differences.pdf", "Capsule Backup Key\nabffc/d+efiZ\n"},
+		// a key wrapped over lines started by T*, ' and Tm, shown with TJ
+		// and Tj
+		{"wrapped.pdf", "CapsuleBackup Key\npGVTZXR1\ncFkRBJiA\nUPK8\nOsFg==\nKeep this document safe\n"},
+	}
+	for _, tt := range tests {
+		got, err := extractPDFText(readFixture(t, tt.file))
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestBackupKeySectionsWrapped(t *testing.T) {
+	text, err := extractPDFText(readFixture(t, "wrapped.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := backupKeySections(text)
+	if len(sections) != 1 || strings.Join(sections[0], "") != "pGVTZXR1cFkRBJiAUPK8OsFg==" {
+		t.Errorf("got sections %q", sections)
+	}
+}
+
+func TestExtractPDFTextMalformed(t *testing.T) {
+	tests := []struct {
+		file, err string
+	}{
+		// a content stream marked Flate that isn't zlib, behind an xref
+		// with a bad offset
+		{"badstream.pdf", "zlib header"},
+		// an xref table and trailer without any objects
+		{"badxref.pdf", "no objects"},
+		{"filter.pdf", "unsupported pdf stream filter"},
+	}
+	for _, tt := range tests {
+		_, err := extractPDFText(readFixture(t, tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want one mentioning %q", tt.file, err, tt.err)
+		}
+	}
+}
+
+// TestExtractPDFTextTruncated checks that every prefix of the fixtures is
+// read without panicking.
+func TestExtractPDFTextTruncated(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "pdf", "*.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data := readFixture(t, filepath.Base(file))
+		for n := range data {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("%s cut at %d bytes: panic %v", file, n, r)
+					}
+				}()
+				extractPDFText(data[:n])
+			}()
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// previewTx prints a transaction the way it's checked before it's signed.
+func previewTx(w io.Writer, tx *types.Transaction, signer types.Signer) {
+	fmt.Fprintln(w, "transaction to sign:")
+	fmt.Fprintf(w, "  type:         %s (0x%02x)\n", txTypeNames[tx.Type()], tx.Type())
+	if chainID := signer.ChainID(); chainID != nil && chainID.Sign() != 0 {
+		fmt.Fprintf(w, "  chain ID:     %s\n", chainID)
+	} else {
+		fmt.Fprintln(w, "  chain ID:     none, the transaction can be replayed on any chain")
+	}
+	fmt.Fprintf(w, "  nonce:        %d\n", tx.Nonce())
+	if to := tx.To(); to != nil {
+		fmt.Fprintf(w, "  to:           %s\n", to.Hex())
+	} else {
+		fmt.Fprintln(w, "  to:           none, the transaction creates a contract")
+	}
+	fmt.Fprintf(w, "  value:        %s ether\n", formatUnits(tx.Value(), 18))
+
+	fmt.Fprintf(w, "  gas limit:    %d\n", tx.Gas())
+	switch tx.Type() {
+	case types.LegacyTxType, types.AccessListTxType:
+		fmt.Fprintf(w, "  gas price:    %s gwei\n", formatUnits(tx.GasPrice(), 9))
+	default:
+		fmt.Fprintf(w, "  max priority: %s gwei\n", formatUnits(tx.GasTipCap(), 9))
+		fmt.Fprintf(w, "  max fee:      %s gwei\n", formatUnits(tx.GasFeeCap(), 9))
+	}
+	if tx.Type() == types.BlobTxType {
+		fmt.Fprintf(w, "  max blob fee: %s gwei for %d blob gas\n", formatUnits(tx.BlobGasFeeCap(), 9), tx.BlobGas())
+	}
+	fmt.Fprintf(w, "  max cost:     %s ether, the value and the most the fees can come to\n", formatUnits(tx.Cost(), 18))
+
+	if tx.Type() != types.LegacyTxType {
+		accessList := tx.AccessList()
+		if len(accessList) == 0 {
+			fmt.Fprintln(w, "  access list:  empty")
+		} else {
+			fmt.Fprintln(w, "  access list:")
+		}
+		for _, tuple := range accessList {
+			fmt.Fprintf(w, "    %s, %d storage keys\n", tuple.Address.Hex(), len(tuple.StorageKeys))
+			for _, key := range tuple.StorageKeys {
+				fmt.Fprintf(w, "      %s\n", key.Hex())
+			}
+		}
+	}
+	if tx.Type() == types.BlobTxType {
+		fmt.Fprintln(w, "  blob hashes:")
+		for _, h := range tx.BlobHashes() {
+			fmt.Fprintf(w, "    %s\n", h.Hex())
+		}
+	}
+
+	data := tx.Data()
+	if len(data) == 0 {
+		fmt.Fprintln(w, "  data:         none")
+		return
+	}
+	fmt.Fprintf(w, "  data:         %d bytes\n", len(data))
+	if tx.To() != nil {
+		printCall(w, "  ", data, 0)
+	}
+}
+
+// formatUnits formats an integer amount of the smallest unit as a decimal
+// number of a unit with the given number of decimals, without rounding.
+func formatUnits(amount *big.Int, decimals int) string {
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(new(big.Int).Abs(amount), unit, new(big.Int))
+	s := whole.String()
+	if frac.Sign() != 0 {
+		digits := fmt.Sprintf("%0*s", decimals, frac.String())
+		s += "." + strings.TrimRight(digits, "0")
+	}
+	if amount.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// previewTypedData prints the domain and the primary type of EIP-712 typed
+// data before it's signed.
+func previewTypedData(w io.Writer, td *typedData) {
+	fmt.Fprintln(w, "typed data to sign:")
+	fmt.Fprintf(w, "  primary type: %s\n", td.PrimaryType)
+	fields := td.Types[eip712Domain]
+	if len(fields) == 0 {
+		fmt.Fprintln(w, "  domain:       none, the signature is valid for any application and chain")
+		return
+	}
+	fmt.Fprintln(w, "  domain:")
+	for _, f := range fields {
+		if v, ok := td.Domain[f.Name]; ok {
+			fmt.Fprintf(w, "    %-18s %v\n", f.Name+":", v)
+		}
+	}
+}
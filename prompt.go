@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	mpcsigner "github.com/capsule-org/go-sdk/signer"
+)
+
+// Control characters handled while reading a hidden secret.
+const (
+	keyInterrupt = 0x03
+	keyEOF       = 0x04
+	keyBackspace = 0x08
+	keyDelete    = 0x7f
+)
+
+// readOrPrompt reads the input from its configured source, or asks for it on
+// the terminal with echo turned off when no source was given.
+func (in *shareInput) readOrPrompt() ([]byte, error) {
+	if in.isSet() {
+		return in.readBytes()
+	}
+	secret, err := promptSecret(in.label)
+	return []byte(secret), err
+}
+
+// promptSecret reads a secret from the controlling terminal without echoing
+// it. The secret may span several lines, as pasted out of the backup kit PDF,
+// and ends with an empty line.
+func promptSecret(label string) (string, error) {
+	tty, err := openTerminal()
+	if err != nil {
+		return "", fmt.Errorf("no %s given and no terminal to prompt on: %w", label, err)
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "Paste the %s, then press Enter on an empty line (input is hidden):\n", label)
+
+	var lines []string
+	err = readHidden(tty, func(r *bufio.Reader) error {
+		lines, err = readHiddenLines(r)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimSpace(strings.Join(lines, "\n"))
+	if secret == "" {
+		return "", errors.New(label + " is empty")
+	}
+	fmt.Fprintf(tty, "Read %d characters.\n", len(secret))
+	return secret, nil
+}
+
+// readHidden runs read with the terminal's echo turned off, and turns it
+// back on even when the user interrupts.
+func readHidden(tty *os.File, read func(r *bufio.Reader) error) error {
+	restore, err := disableEcho(tty)
+	if err != nil {
+		return fmt.Errorf("disabling terminal echo: %w", err)
+	}
+
+	// make sure the terminal doesn't stay silent if the user gives up halfway
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigs:
+			restore()
+			fmt.Fprintln(tty)
+			os.Exit(exitFailure)
+		case <-done:
+		}
+	}()
+
+	err = read(bufio.NewReader(tty))
+
+	close(done)
+	signal.Stop(sigs)
+	restore()
+	return err
+}
+
+// readHiddenLines collects lines until an empty line follows some input, or
+// until end of input.
+func readHiddenLines(r *bufio.Reader) ([]string, error) {
+	var lines []string
+	for {
+		line, more, err := readHiddenLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" && len(lines) > 0 {
+			return lines, nil
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if !more {
+			return lines, nil
+		}
+	}
+}
+
+// readHiddenLine reads one line typed with echo and canonical mode turned
+// off, applying backspaces itself. more is false once the input has ended.
+func readHiddenLine(r *bufio.Reader) (line string, more bool, err error) {
+	var b []byte
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			c = keyEOF
+		} else if err != nil {
+			return "", false, err
+		}
+
+		switch c {
+		case '\r', '\n':
+			return string(b), true, nil
+		case keyEOF:
+			return string(b), false, nil
+		case keyInterrupt:
+			return "", false, errors.New("interrupted")
+		case keyBackspace, keyDelete:
+			if len(b) > 0 {
+				b = b[:len(b)-1]
+			}
+		default:
+			b = append(b, c)
+		}
+	}
+}
+
+// promptPassphrase asks for a new passphrase twice on the terminal without
+// echoing it.
+func promptPassphrase(purpose string) (string, error) {
+	tty, err := openTerminal()
+	if err != nil {
+		return "", fmt.Errorf("no terminal to ask for the passphrase on: %w", err)
+	}
+	defer tty.Close()
+
+	var first, second string
+	err = readHidden(tty, func(r *bufio.Reader) error {
+		fmt.Fprintf(tty, "Passphrase to %s (input is hidden): ", purpose)
+		first, _, err = readHiddenLine(r)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(tty, "\nRepeat the passphrase: ")
+		second, _, err = readHiddenLine(r)
+		fmt.Fprintln(tty)
+		return err
+	})
+	switch {
+	case err != nil:
+		return "", err
+	case first != second:
+		return "", errors.New("the passphrases don't match")
+	case first == "":
+		return "", errors.New("the passphrase is empty")
+	}
+	return first, nil
+}
+
+// confirmWallet shows which wallet a user share belongs to and asks the user
+// to confirm it before any further secret is entered.
+func confirmWallet(userSigner *mpcsigner.DKLSSigner) error {
+	tty, err := openTerminal()
+	if err != nil {
+		return fmt.Errorf("no terminal to confirm the wallet on: %w", err)
+	}
+	defer tty.Close()
+
+	address, err := userSigner.GetAddress()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(tty)
+	fmt.Fprintf(tty, "wallet ID: %s\n", userSigner.GetWalletId())
+	fmt.Fprintf(tty, "address:   %s\n", address)
+	return askYesNo(tty, "Is this the wallet you want to continue with?", "the wallet was not confirmed")
+}
+
+// confirmOnTerminal asks a yes or no question on the terminal and fails with
+// refusal unless it's answered with yes.
+func confirmOnTerminal(question, refusal string) error {
+	tty, err := openTerminal()
+	if err != nil {
+		return fmt.Errorf("no terminal to confirm on, %s: %w", refusal, err)
+	}
+	defer tty.Close()
+	return askYesNo(tty, question, refusal)
+}
+
+func askYesNo(tty *os.File, question, refusal string) error {
+	fmt.Fprintf(tty, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errors.New("aborted, " + refusal)
+}
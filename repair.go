@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+	// maxRepairCandidates bounds the number of keys tried for one tier.
+	maxRepairCandidates = 1 << 21
+	// repairBatchSize is the number of candidates checked in parallel at once.
+	repairBatchSize = 4096
+)
+
+// lookalikes maps characters a pdf viewer may produce for base64 characters
+// to the characters they can stand for.
+var lookalikes = map[rune][]string{
+	'ﬀ': {"ff"}, 'ﬁ': {"fi"}, 'ﬂ': {"fl"}, 'ﬃ': {"ffi"}, 'ﬄ': {"ffl"}, 'ﬅ': {"st"}, 'ﬆ': {"st"},
+	'А': {"A"}, 'В': {"B"}, 'Е': {"E"}, 'К': {"K"}, 'М': {"M"}, 'Н': {"H"}, 'О': {"O"},
+	'Р': {"P"}, 'С': {"C"}, 'Т': {"T"}, 'Х': {"X"}, 'І': {"I"}, 'Ј': {"J"}, 'Ѕ': {"S"},
+	'а': {"a"}, 'е': {"e"}, 'о': {"o"}, 'р': {"p"}, 'с': {"c"}, 'у': {"y"}, 'х': {"x"},
+	'і': {"i"}, 'ј': {"j"}, 'ѕ': {"s"},
+	'Α': {"A"}, 'Β': {"B"}, 'Ε': {"E"}, 'Ζ': {"Z"}, 'Η': {"H"}, 'Ι': {"I"}, 'Κ': {"K"},
+	'Μ': {"M"}, 'Ν': {"N"}, 'Ο': {"O"}, 'Ρ': {"P"}, 'Τ': {"T"}, 'Υ': {"Y"}, 'Χ': {"X"},
+	'ο': {"o"}, 'ν': {"v"}, 'ı': {"i"}, 'ℓ': {"l"},
+	'∕': {"/"}, '⁄': {"/"}, '∖': {"/"},
+	'|': {"l", "I", "1"}, 'ǀ': {"l", "I"},
+}
+
+// repairSpan is a run of characters in a backup key that can't be base64.
+type repairSpan struct {
+	// offset is the character offset of the span in the key without whitespace.
+	offset int
+	text   string
+}
+
+// repairFix records the replacement chosen for a span.
+type repairFix struct {
+	span        repairSpan
+	replacement string
+}
+
+func (f repairFix) String() string {
+	return fmt.Sprintf("character %d: %q -> %q", f.span.offset, f.span.text, f.replacement)
+}
+
+// repairBackupKey turns the backup key as copied out of the pdf into the
+// exact config of the wallet's other party.
+//
+// Each run of non-base64 characters is replaced by candidate fixes, from
+// known pdf artifacts to arbitrary characters, and a candidate is only
+// accepted once it decodes to a config of the opposite role that completes
+// the user's share to the wallet's public key. Tiers with too many
+// candidates to try, or no candidates beyond the previous tier's, are
+// skipped. A key that is all base64 but doesn't decode is tried with one
+// dropped character put back. If a tier of candidates yields more than one
+// such key the repair is refused rather than guessed.
+func repairBackupKey(key string, user *dklsShare) (string, []repairFix, error) {
+	lines := strings.Fields(key)
+	key = strings.Join(lines, "")
+	parts, spans := splitRepairSpans(key)
+	if len(spans) == 0 {
+		if user == nil {
+			return key, nil, nil
+		}
+		if _, err := decodeShareConfig(key, !user.isReceiver); err == nil {
+			return key, nil, nil
+		}
+		return repairDroppedCharacter(key, lines, newBackupCheck(user))
+	}
+	if user == nil {
+		return "", nil, errors.New("the backup key is damaged and there is no user share to check repairs against")
+	}
+
+	check := newBackupCheck(user)
+
+	fixedLen := 0
+	for _, p := range parts {
+		fixedLen += len(p)
+	}
+
+	searched := false
+	var previous [][]string
+	for tier := 0; tier < repairTiers; tier++ {
+		candidates := make([][]string, len(spans))
+		total, widened := 1, previous == nil
+		for i, span := range spans {
+			candidates[i] = spanCandidates(span.text, tier)
+			total *= len(candidates[i])
+			// tiers only ever add candidates
+			widened = widened || len(candidates[i]) != len(previous[i])
+		}
+		previous = candidates
+		if !widened || total > maxRepairCandidates {
+			// nothing new, or too many to try
+			continue
+		}
+		searched = true
+
+		found := searchRepairs(parts, candidates, fixedLen, total, check)
+		if len(found) > 1 {
+			return "", nil, fmt.Errorf("the damaged backup key has %d different repairs that match the wallet, fix it by hand", len(found))
+		}
+		if len(found) == 1 {
+			fixes := make([]repairFix, len(spans))
+			for i, span := range spans {
+				fixes[i] = repairFix{span: span, replacement: candidates[i][found[0][i]]}
+			}
+			return joinRepair(parts, candidates, found[0]), fixes, nil
+		}
+	}
+
+	// no repair can help a key from another refresh of the wallet, which
+	// shows once the damage is outside the values compared
+	likely := make([][]string, len(spans))
+	for i, span := range spans {
+		likely[i] = spanCandidates(span.text, 0)
+	}
+	first := joinRepair(parts, likely, make([]int, len(spans)))
+	if backup, err := decodeShareConfig(first, !user.isReceiver); err == nil && user.refreshedApart(backup) {
+		return "", nil, errRefreshGeneration
+	}
+	if !searched {
+		return "", nil, fmt.Errorf("the backup key has too many damaged spans to repair automatically (%d)", len(spans))
+	}
+	return "", nil, fmt.Errorf("none of the candidate repairs for %d damaged span(s) of the backup key match the wallet", len(spans))
+}
+
+// repairDroppedCharacter looks for the one character missing from a key that
+// is all base64. When the key was given in lines of one width and one line
+// is a character short, only that line is searched, otherwise every
+// position is.
+func repairDroppedCharacter(key string, lines []string, check *backupCheck) (string, []repairFix, error) {
+	if (len(key)+1)%4 != 0 {
+		return "", nil, errors.New("the backup key doesn't decode, and isn't one character short of a valid length")
+	}
+	start, end := shortLine(lines)
+	if (end-start+1)*len(base64Alphabet) > maxRepairCandidates {
+		return "", nil, errors.New("the backup key doesn't decode, and is too long to search for a dropped character")
+	}
+
+	var found []repairFix
+	for i := start; i <= end; i++ {
+		var chars []string
+		for _, c := range base64Alphabet + "=" {
+			// putting c back after an equal character gives the same key
+			if (i > 0 && rune(key[i-1]) == c) || (c == '=' && i < len(key)-1) {
+				continue
+			}
+			chars = append(chars, string(c))
+		}
+		parts := []string{key[:i], key[i:]}
+		for _, indices := range searchRepairs(parts, [][]string{chars}, len(key), len(chars), check) {
+			found = append(found, repairFix{span: repairSpan{offset: i}, replacement: chars[indices[0]]})
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil, errors.New("the backup key doesn't decode, and no character put back into it matches the wallet")
+	case 1:
+		fix := found[0]
+		return key[:fix.span.offset] + fix.replacement + key[fix.span.offset:], found, nil
+	}
+	return "", nil, fmt.Errorf("the backup key has %d different dropped characters that match the wallet, fix it by hand", len(found))
+}
+
+// shortLine returns the range of positions a dropped character may be put
+// back at: the line that is a character short of the others' width, or the
+// last line if no other is short, or the whole key.
+func shortLine(lines []string) (start, end int) {
+	total := 0
+	for _, line := range lines {
+		total += len(line)
+	}
+	if len(lines) < 3 {
+		return 0, total
+	}
+	width := len(lines[0])
+	for _, line := range lines[1 : len(lines)-1] {
+		width = max(width, len(line))
+	}
+
+	short := len(lines) - 1
+	for n, line := range lines[:len(lines)-1] {
+		switch {
+		case len(line) == width:
+		case len(line) == width-1 && short == len(lines)-1:
+			short = n
+		default:
+			return 0, total
+		}
+	}
+	if short == len(lines)-1 && len(lines[short]) >= width {
+		return 0, total
+	}
+	for _, line := range lines[:short] {
+		start += len(line)
+	}
+	return start, start + len(lines[short])
+}
+
+// splitRepairSpans splits key into the base64 parts around each span, so
+// that parts has one more element than spans.
+func splitRepairSpans(key string) ([]string, []repairSpan) {
+	var parts []string
+	var spans []repairSpan
+	start, offset := 0, 0
+	var span *repairSpan
+	for i, r := range key {
+		bad := r >= utf8.RuneSelf || !strings.ContainsRune(base64Alphabet+"=", r)
+		switch {
+		case bad && span == nil:
+			parts = append(parts, key[start:i])
+			span = &repairSpan{offset: offset}
+			start = i
+		case !bad && span != nil:
+			span.text = key[start:i]
+			spans = append(spans, *span)
+			span = nil
+			start = i
+		}
+		offset++
+	}
+	if span != nil {
+		span.text = key[start:]
+		spans = append(spans, *span)
+		parts = append(parts, "")
+	} else {
+		parts = append(parts, key[start:])
+	}
+	return parts, spans
+}
+
+// repairTiers is the number of candidate tiers produced by spanCandidates.
+const repairTiers = 3
+
+// spanCandidates returns the replacements tried for a span in the given tier.
+//
+// Spans made only of ligatures and lookalike characters are replaced by the
+// characters they stand for. Any other span is taken to be the "ff" ligature
+// the pdf usually mangles in tier 0, and tier 1 adds dropped characters and
+// arbitrary one or two character values. Tier 2 widens lookalike spans the
+// same way, so for a key with spans of one kind only, one of the two adds
+// nothing and is skipped.
+func spanCandidates(text string, tier int) []string {
+	mapped := []string{""}
+	for _, r := range text {
+		subs, ok := lookalikes[r]
+		if !ok && r >= 0xff01 && r <= 0xff5e {
+			// fullwidth forms of ascii characters
+			subs, ok = []string{string(r - 0xfee0)}, true
+		}
+		if !ok {
+			mapped = nil
+			break
+		}
+		var next []string
+		for _, prefix := range mapped {
+			for _, s := range subs {
+				next = append(next, prefix+s)
+			}
+		}
+		mapped = next
+	}
+	if len(mapped) > 0 && tier < 2 {
+		return mapped
+	}
+	if len(mapped) == 0 && tier == 0 {
+		return []string{"ff"}
+	}
+
+	seen := map[string]bool{}
+	var out []string
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	for _, s := range mapped {
+		add(s)
+	}
+	add("ff")
+	add("")
+	for _, a := range base64Alphabet {
+		add(string(a))
+	}
+	for _, a := range base64Alphabet {
+		for _, b := range base64Alphabet {
+			add(string(a) + string(b))
+		}
+	}
+	return out
+}
+
+// searchRepairs tries every combination of span candidates and returns the
+// candidate indices of those that pass the check.
+func searchRepairs(parts []string, candidates [][]string, fixedLen, total int, check *backupCheck) [][]int {
+	var found [][]int
+	indices := make([]int, len(candidates))
+	for n := 0; n < total; {
+		var batch [][]int
+		for ; n < total && len(batch) < repairBatchSize; n++ {
+			length := fixedLen
+			for i, idx := range indices {
+				length += len(candidates[i][idx])
+			}
+			// base64 without a valid length can't decode, skip it early
+			if length%4 == 0 {
+				batch = append(batch, append([]int(nil), indices...))
+			}
+			for i := len(indices) - 1; i >= 0; i-- {
+				indices[i]++
+				if indices[i] < len(candidates[i]) {
+					break
+				}
+				indices[i] = 0
+			}
+		}
+
+		results := make([]bool, len(batch))
+		parallelize(len(batch), func(i int) {
+			results[i] = check.accept(joinRepair(parts, candidates, batch[i]))
+		})
+		for i, ok := range results {
+			if ok {
+				found = append(found, batch[i])
+			}
+		}
+	}
+	return found
+}
+
+// parallelize calls f for 0..count-1 spread over one goroutine per CPU.
+//
+// pool.Parallelize isn't used: a worker can decrement the counter and be
+// left blocked signalling it after the caller returned, which deadlocks the
+// next call once every worker is stuck.
+func parallelize(count int, f func(i int)) {
+	workers := min(runtime.NumCPU(), count)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < count; i += workers {
+				f(i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func joinRepair(parts []string, candidates [][]string, indices []int) string {
+	var b strings.Builder
+	for i, p := range parts {
+		b.WriteString(p)
+		if i < len(indices) {
+			b.WriteString(candidates[i][indices[i]])
+		}
+	}
+	return b.String()
+}
+
+// backupCheck decides whether a backup key belongs to the wallet of a user
+// share.
+type backupCheck struct {
+	user *dklsShare
+}
+
+func newBackupCheck(user *dklsShare) *backupCheck {
+	return &backupCheck{user: user}
+}
+
+// accept reports whether key decodes to a config of the opposite role whose
+// secret share completes the user's share to the shared public key, and
+// whose OT setup matches the user's.
+func (c *backupCheck) accept(key string) bool {
+	backup, err := decodeShareConfig(key, !c.user.isReceiver)
+	if err != nil {
+		return false
+	}
+	// the byte comparisons weed out most candidates before any scalar
+	// multiplication is done
+	if !backup.public.Equal(c.user.public) || !bytes.Equal(backup.chainKey, c.user.chainKey) || c.user.otSetupsMatch(backup) != nil {
+		return false
+	}
+	return c.user.pairs(backup) == nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	mpcsigner "github.com/capsule-org/go-sdk/signer"
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+	"github.com/capsule-org/multi-party-sig/pkg/pool"
+	"github.com/capsule-org/multi-party-sig/pkg/protocol"
+	"github.com/capsule-org/multi-party-sig/protocols/doerner"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// testWallet is a wallet made by running keygen and one refresh in-process,
+// with the user as the sender and the backup as the receiver.
+type testWallet struct {
+	user *dklsShare
+	// backup is the backup key of the keygen, refreshed the one of the
+	// refresh.
+	backup, refreshed string
+	// backupShare is the encoded secret share of backup.
+	backupShare []byte
+}
+
+func runTwoParty(t *testing.T, a, b *protocol.TwoPartyHandler) {
+	t.Helper()
+	var wg sync.WaitGroup
+	pump := func(from, to *protocol.TwoPartyHandler) {
+		defer wg.Done()
+		for msg := range from.Listen() {
+			to.Accept(msg)
+		}
+	}
+	wg.Add(2)
+	go pump(a, b)
+	go pump(b, a)
+	wg.Wait()
+}
+
+func runSession(t *testing.T, sid string, receiver, sender protocol.StartFunc) (*doerner.ConfigReceiver, *doerner.ConfigSender) {
+	t.Helper()
+	recv, err := protocol.NewTwoPartyHandler(receiver, []byte(sid), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send, err := protocol.NewTwoPartyHandler(sender, []byte(sid), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runTwoParty(t, recv, send)
+	rr, err := recv.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr, err := send.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr.(*doerner.ConfigReceiver), sr.(*doerner.ConfigSender)
+}
+
+func newTestWallet(t *testing.T) *testWallet {
+	t.Helper()
+	pl := pool.NewPool(0)
+	defer pl.TearDown()
+
+	rc, sc := runSession(t, "keygen", doerner.Keygen(curve.Secp256k1{}, true, "CAPSULE", "USER", pl), doerner.Keygen(curve.Secp256k1{}, false, "USER", "CAPSULE", pl))
+	rc2, _ := runSession(t, "refresh", doerner.RefreshReceiver(rc, "CAPSULE", "USER", pl), doerner.RefreshSender(sc, "USER", "CAPSULE", pl))
+
+	signer := mpcsigner.NewDKLSSigner("", "wallet", "USER", "CAPSULE", nil, nil, sc, false, nil)
+	user, err := signerShare(&signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(c *doerner.ConfigReceiver) string {
+		raw, err := cbor.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(raw)
+	}
+	share, err := rc.SecretShare.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testWallet{user: user, backup: encode(rc), refreshed: encode(rc2), backupShare: share}
+}
+
+// damage replaces the characters of key at the given offsets.
+func damage(key string, subs map[int]string) string {
+	var b strings.Builder
+	for i, r := range key {
+		if s, ok := subs[i]; ok {
+			b.WriteString(s)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// shareOffset returns the offset of a character of key that encodes only
+// bits of the secret share, so any other value for it breaks the share.
+func shareOffset(t *testing.T, key string, share []byte) int {
+	t.Helper()
+	raw, _ := base64.StdEncoding.DecodeString(key)
+	at := bytes.Index(raw, share)
+	if at < 0 {
+		t.Fatal("the secret share isn't in the backup key")
+	}
+	return (at+3)/3*4 + 1
+}
+
+// lookalikeOffset returns the offset of the first character of key from
+// start on that a Cyrillic lookalike stands for, with the lookalike.
+func lookalikeOffset(t *testing.T, key string, start int) (int, string) {
+	t.Helper()
+	cyrillic := map[byte]string{'A': "А", 'B': "В", 'E': "Е", 'K': "К", 'M': "М", 'O': "О", 'P': "Р", 'C': "С", 'T': "Т", 'X': "Х"}
+	for i := start; i < len(key); i++ {
+		if s, ok := cyrillic[key[i]]; ok {
+			return i, s
+		}
+	}
+	t.Fatal("the backup key has no character with a lookalike")
+	return 0, ""
+}
+
+func TestRepairBackupKeyAcrossTiers(t *testing.T) {
+	w := newTestWallet(t)
+
+	// a lookalike, which tier 0 maps back, and an unreadable character,
+	// which only the arbitrary characters of tier 1 can fix
+	broken := shareOffset(t, w.backup, w.backupShare)
+	look, lookalike := lookalikeOffset(t, w.backup, 0)
+	if look >= broken-1 {
+		t.Skip("the backup key has no lookalike character before its secret share")
+	}
+	key := damage(w.backup, map[int]string{look: lookalike, broken: "�"})
+
+	repaired, fixes, err := repairBackupKey(key, w.user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired != w.backup {
+		t.Fatal("the repaired backup key differs from the original")
+	}
+	if len(fixes) != 2 || fixes[0].replacement != w.backup[look:look+1] || fixes[1].replacement != w.backup[broken:broken+1] {
+		t.Fatalf("unexpected fixes %v", fixes)
+	}
+}
+
+func TestRepairBackupKeyRefreshGeneration(t *testing.T) {
+	w := newTestWallet(t)
+
+	// two lookalikes leave tier 2 too large to search, which must not hide
+	// that the backup key is from another refresh
+	first, s1 := lookalikeOffset(t, w.refreshed, 0)
+	second, s2 := lookalikeOffset(t, w.refreshed, first+2)
+	key := damage(w.refreshed, map[int]string{first: s1, second: s2})
+
+	_, _, err := repairBackupKey(key, w.user)
+	if !errors.Is(err, errRefreshGeneration) {
+		t.Fatalf("got %v, want the refresh generation error", err)
+	}
+}
+
+// inLines splits key into lines of width characters, as the pdf prints it.
+func inLines(key string, width int) string {
+	var lines []string
+	for len(key) > width {
+		lines = append(lines, key[:width])
+		key = key[width:]
+	}
+	return strings.Join(append(lines, key), "\n")
+}
+
+func TestRepairBackupKeyDroppedCharacter(t *testing.T) {
+	w := newTestWallet(t)
+
+	// the character goes missing from one of the lines the key is shown in
+	dropped := shareOffset(t, w.backup, w.backupShare)
+	lined := inLines(w.backup, 70)
+	at := dropped + dropped/70
+	key := lined[:at] + lined[at+1:]
+
+	repaired, fixes, err := repairBackupKey(key, w.user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired != w.backup {
+		t.Fatal("the repaired backup key differs from the original")
+	}
+	if len(fixes) != 1 || fixes[0].replacement != w.backup[dropped:dropped+1] {
+		t.Fatalf("unexpected fixes %v", fixes)
+	}
+}
+
+func TestShortLine(t *testing.T) {
+	tests := []struct {
+		lines      []string
+		start, end int
+	}{
+		{[]string{"AAAA", "AAA", "AAAA", "AA"}, 4, 7},
+		{[]string{"AAAA", "AAAA", "AAAA", "AA"}, 12, 14},
+		{[]string{"AAAA", "AAA", "AAA", "AA"}, 0, 12},
+		{[]string{"AAAA", "AA", "AAAA", "AA"}, 0, 12},
+		{[]string{"AAAA", "AAAA", "AAAA"}, 0, 12},
+		{[]string{"AAAAAAA"}, 0, 7},
+	}
+	for _, tt := range tests {
+		if start, end := shortLine(tt.lines); start != tt.start || end != tt.end {
+			t.Errorf("%q: got %d to %d, want %d to %d", tt.lines, start, end, tt.start, tt.end)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	mpcsigner "github.com/capsule-org/go-sdk/signer"
+)
+
+// shareFormat names one of the shapes a share can be given in.
+type shareFormat string
+
+const (
+	formatDKLSJSON       shareFormat = "DKLS signer JSON"
+	formatRecoverySecret shareFormat = "snaps recovery secret"
+	formatBase64         shareFormat = "base64-wrapped signer JSON"
+	formatWalletObject   shareFormat = "frontend wallet object"
+	formatED25519        shareFormat = "ED25519 serialized signer"
+	formatCMPJSON        shareFormat = "CMP signer JSON"
+	formatBackupKey      shareFormat = "Capsule backup key"
+	formatBackupPDF      shareFormat = "CapsuleBackupShare.pdf"
+)
+
+// maxShareNesting bounds how many wrappers are peeled off a share.
+const maxShareNesting = 4
+
+// loadedShare is a share whose format has been detected, deserialized with
+// the matching deserializer.
+type loadedShare struct {
+	// formats lists the detected formats from the outermost wrapper inwards.
+	formats []shareFormat
+
+	dkls       *mpcsigner.DKLSSigner
+	dklsParams *mpcsigner.DKLSSerializableSigner
+	ed25519    *mpcsigner.ED25519Signer
+	cmp        *mpcsigner.Signer
+	// backupKey is a bare receiver config as found in the backup kit. It is
+	// kept as text, since it may still need repairs.
+	backupKey string
+}
+
+func (s *loadedShare) describe() string {
+	parts := make([]string, len(s.formats))
+	for i, f := range s.formats {
+		parts[i] = string(f)
+	}
+	return strings.Join(parts, " > ")
+}
+
+// loadUserShare reads the user share and deserializes it according to its
+// detected format.
+func loadUserShare(in *shareInput) (*loadedShare, error) {
+	data, err := in.readOrPrompt()
+	if err != nil {
+		return nil, err
+	}
+	share, err := classifyShare(data, false)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", in.label, err)
+	}
+	fmt.Fprintf(os.Stderr, "%s: detected %s\n", in.label, share.describe())
+	return share, nil
+}
+
+// loadBackupShare reads the Capsule backup share and deserializes it
+// according to its detected format. A backup key that doesn't decode, bare
+// or read out of the pdf, is returned as is, to be repaired against the user
+// share.
+func loadBackupShare(in *shareInput) (*loadedShare, error) {
+	data, err := in.readOrPrompt()
+	if err != nil {
+		return nil, err
+	}
+	share, err := classifyShare(data, true)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", in.label, err)
+	}
+	fmt.Fprintf(os.Stderr, "%s: detected %s\n", in.label, share.describe())
+	return share, nil
+}
+
+// dklsUserSigner returns the DKLS signer of a user share, or explains why the
+// share can't be used as one.
+func (s *loadedShare) dklsUserSigner() (*mpcsigner.DKLSSigner, error) {
+	switch {
+	case s.dkls != nil:
+		return s.dkls, nil
+	case s.ed25519 != nil:
+		return nil, errors.New("ED25519 shares are not DKLS shares and can't be used with a Capsule backup key")
+	case s.cmp != nil:
+		return nil, errors.New("CMP shares are not DKLS shares and can't be used with a Capsule backup key")
+	}
+	return nil, errors.New("the user share is a backup key, not a user share")
+}
+
+// backupConfig returns the base64 config held by a backup share, which must
+// be in the opposite role of the user share.
+func (s *loadedShare) backupConfig(userIsReceiver bool) (string, error) {
+	switch {
+	case s.backupKey != "":
+		return s.backupKey, nil
+	case s.dkls != nil && s.dklsParams.IsReceiver == userIsReceiver:
+		return "", fmt.Errorf("the backup share is a %s share like the user share", roleName(userIsReceiver))
+	case s.dkls != nil && s.dklsParams.IsReceiver:
+		return s.dklsParams.ReceiverConfig, nil
+	case s.dkls != nil:
+		return s.dklsParams.SenderConfig, nil
+	}
+	return "", errors.New("the backup share is not a DKLS share")
+}
+
+// classifyShare detects the format of a share and deserializes it. When
+// backup is set, the input may also be the backup kit pdf or a bare backup key.
+func classifyShare(data []byte, backup bool) (*loadedShare, error) {
+	if backup && isPDF(data) {
+		key, err := backupKeyFromPDF(data)
+		if err != nil {
+			return nil, err
+		}
+		return &loadedShare{formats: []shareFormat{formatBackupPDF, formatBackupKey}, backupKey: key}, nil
+	}
+
+	text := strings.TrimSpace(string(data))
+	share, err := classifyText(text, 0)
+	if err != nil && backup && !strings.HasPrefix(text, "{") {
+		// possibly a damaged key copied out of the pdf, leave it to the repair
+		return &loadedShare{formats: []shareFormat{formatBackupKey}, backupKey: text}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if share.backupKey != "" && !backup {
+		return nil, errors.New("this is a Capsule backup key, not a user share")
+	}
+	return share, nil
+}
+
+func classifyText(text string, depth int) (*loadedShare, error) {
+	if depth > maxShareNesting {
+		return nil, errors.New("share is wrapped too many times")
+	}
+	if text == "" {
+		return nil, errors.New("share is empty")
+	}
+
+	if strings.HasPrefix(text, "{") {
+		return classifyJSON(text, depth)
+	}
+
+	// the snaps recovery secret is the share, base64 encoded after a "|"
+	if _, encoded, ok := strings.Cut(text, "|"); ok {
+		decoded, err := decodeBase64(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("recovery secret: %w", err)
+		}
+		return wrapShare(formatRecoverySecret, string(decoded), depth)
+	}
+
+	decoded, err := decodeBase64(text)
+	if err != nil {
+		return nil, errors.New("unrecognized share format")
+	}
+	if trimmed := bytes.TrimSpace(decoded); bytes.HasPrefix(trimmed, []byte("{")) {
+		if isED25519JSON(trimmed) {
+			signer, err := mpcsigner.ED25519DeserializeSigner(base64.StdEncoding.EncodeToString(trimmed))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", formatED25519, err)
+			}
+			return &loadedShare{formats: []shareFormat{formatED25519}, ed25519: signer}, nil
+		}
+		return wrapShare(formatBase64, string(trimmed), depth)
+	}
+
+	// a bare config is a cbor map
+	if len(decoded) > 0 && decoded[0]>>5 == cborMap {
+		return &loadedShare{formats: []shareFormat{formatBackupKey}, backupKey: text}, nil
+	}
+	return nil, errors.New("unrecognized share format")
+}
+
+func wrapShare(format shareFormat, inner string, depth int) (*loadedShare, error) {
+	share, err := classifyText(strings.TrimSpace(inner), depth+1)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", format, err)
+	}
+	share.formats = append([]shareFormat{format}, share.formats...)
+	return share, nil
+}
+
+func classifyJSON(text string, depth int) (*loadedShare, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		return nil, fmt.Errorf("share looks like JSON but doesn't parse: %w", err)
+	}
+	// field returns the key that matches name regardless of case
+	field := func(name string) (string, bool) {
+		for key := range fields {
+			if strings.EqualFold(key, name) {
+				return key, true
+			}
+		}
+		return "", false
+	}
+	has := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := field(name); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	signerKey, hasSigner := field("signer")
+
+	switch {
+	case hasSigner:
+		var signer string
+		if err := json.Unmarshal(fields[signerKey], &signer); err != nil {
+			return nil, fmt.Errorf("%s: the signer field is not a string", formatWalletObject)
+		}
+		return wrapShare(formatWalletObject, signer, depth)
+
+	case has("receiverConfig") || has("senderConfig"):
+		var params mpcsigner.DKLSSerializableSigner
+		if err := json.Unmarshal([]byte(text), &params); err != nil {
+			return nil, fmt.Errorf("%s: %w", formatDKLSJSON, err)
+		}
+		signer, err := mpcsigner.DKLSDeserializeSigner(text, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", formatDKLSJSON, err)
+		}
+		if share, err := signerShare(signer); err != nil || share.secretShare.IsZero() {
+			return nil, fmt.Errorf("%s: the signer has no %s config", formatDKLSJSON, roleName(params.IsReceiver))
+		}
+		return &loadedShare{formats: []shareFormat{formatDKLSJSON}, dkls: signer, dklsParams: &params}, nil
+
+	case has("Config", "Ids"):
+		signer, err := mpcsigner.DeserializeSigner(text, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", formatCMPJSON, err)
+		}
+		return &loadedShare{formats: []shareFormat{formatCMPJSON}, cmp: signer}, nil
+
+	case isED25519JSON([]byte(text)):
+		signer, err := mpcsigner.ED25519DeserializeSigner(base64.StdEncoding.EncodeToString([]byte(text)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", formatED25519, err)
+		}
+		return &loadedShare{formats: []shareFormat{formatED25519}, ed25519: signer}, nil
+	}
+	return nil, errors.New("unrecognized JSON share, expected a DKLS, CMP or ED25519 signer or a wallet object")
+}
+
+// isED25519JSON reports whether data is the JSON form of an ED25519Signer.
+func isED25519JSON(data []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	_, hasOutput := fields["Output"]
+	_, hasId := fields["Id"]
+	return hasOutput && hasId
+}
+
+// decodeBase64 accepts both padded and unpadded standard base64, ignoring
+// line breaks.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	if decoded, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return decoded, nil
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var signCommand = &command{
+	name:    "sign",
+	summary: "Sign a 32-byte hash with the user share and the Capsule backup share, without reconstructing the private key.\n\nThe two shares run the DKLS signing protocol against each other in-process, so the private key never exists in memory. A private key exported earlier can be given instead of the shares. The signature is printed as the 65 bytes r || s || v, with v the recovery id 0 or 1.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var signing signingInputs
+		var hashHex string
+		signing.register(fs)
+		fs.StringVar(&hashHex, "hash", "", "sign the 32-byte `hex` hash")
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -user-share-* and -backup-share-* flags")
+			}
+			if hashHex == "" {
+				return usageErrorf("no hash given, use -hash")
+			}
+			hash, err := decodeHex(hashHex)
+			if err != nil || len(hash) != 32 {
+				return usageErrorf("-hash must be 32 bytes of hex")
+			}
+			if err := checkStdin(signing.inputs()...); err != nil {
+				return err
+			}
+
+			s, err := signing.load()
+			if err != nil {
+				return err
+			}
+			sig, err := s.signHash(hash)
+			if err != nil {
+				return err
+			}
+			if _, ok := s.(*walletPair); ok {
+				fmt.Fprintln(os.Stderr, "signed with both shares in-process, the private key was never reconstructed")
+			}
+			fmt.Println("signature hex:")
+			fmt.Println("0x" + hex.EncodeToString(sig))
+			return nil
+		}
+	},
+}
+
+// checkPoints checks that the two halves belong to one wallet by their
+// public points alone, so the secret shares are never combined.
+func (p *walletPair) checkPoints() error {
+	if p.backupWalletId != "" && p.backupWalletId != p.user.GetWalletId() {
+		return fmt.Errorf("the user share belongs to wallet %s, the backup share to wallet %s", p.user.GetWalletId(), p.backupWalletId)
+	}
+	backupKey, err := signerShare(p.backup)
+	if err != nil {
+		return err
+	}
+	return p.userKey.pairs(backupKey)
+}
+
+// signHash co-signs a hash with the two halves of the wallet and returns the
+// signature in Ethereum's 65-byte form, once it recovers to the wallet's
+// address.
+func (p *walletPair) signHash(hash []byte) ([]byte, error) {
+	if err := p.checkPoints(); err != nil {
+		return nil, fmt.Errorf("refusing to sign: %w", err)
+	}
+	receiver, sender := p.user, p.backup
+	if !p.userKey.isReceiver {
+		receiver, sender = p.backup, p.user
+	}
+	sig, err := cosign(receiver, sender, p.userKey.public, hash)
+	if err != nil {
+		return nil, fmt.Errorf("signing failed: %w", err)
+	}
+	sigEth, err := sig.SigEthereum()
+	if err != nil {
+		return nil, err
+	}
+	address, err := p.address()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRecovery(hash, sigEth, address); err != nil {
+		return nil, err
+	}
+	return sigEth, nil
+}
+
+func (p *walletPair) address() (common.Address, error) {
+	return ethereumAddress(p.userKey.public)
+}
+
+// checkRecovery checks that an Ethereum signature of hash recovers to want.
+func checkRecovery(hash, sig []byte, want common.Address) error {
+	got, err := recoverSigner(hash, sig)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("the signature recovers to %s instead of the wallet's address %s", got.Hex(), want.Hex())
+	}
+	return nil
+}
+
+// decodeHex decodes hex with or without a 0x prefix.
+func decodeHex(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	return hex.DecodeString(s)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// hashSigner signs 32-byte hashes for one wallet. Signatures are in
+// Ethereum's 65-byte r || s || v form with v the recovery id 0 or 1, and
+// recover to the signer's address.
+type hashSigner interface {
+	signHash(hash []byte) ([]byte, error)
+	address() (common.Address, error)
+}
+
+// keySigner signs with a private key exported earlier.
+type keySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *keySigner) signHash(hash []byte) ([]byte, error) {
+	sig, err := crypto.Sign(hash, s.key)
+	if err != nil {
+		return nil, err
+	}
+	address, _ := s.address()
+	if err := checkRecovery(hash, sig, address); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func (s *keySigner) address() (common.Address, error) {
+	return crypto.PubkeyToAddress(s.key.PublicKey), nil
+}
+
+// recoverSigner returns the address that signed hash. The recovery id v of
+// the 65-byte signature may be 0 or 1, or 27 or 28 as personal_sign and
+// eth_signTypedData give it.
+func recoverSigner(hash, sig []byte) (common.Address, error) {
+	if len(hash) != 32 {
+		return common.Address{}, fmt.Errorf("the hash is %d bytes long instead of 32", len(hash))
+	}
+	if len(sig) != 65 {
+		return common.Address{}, fmt.Errorf("the signature is %d bytes long instead of 65", len(sig))
+	}
+	sig = bytes.Clone(sig)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	if sig[64] > 1 {
+		return common.Address{}, fmt.Errorf("the signature has recovery id %d, not 0, 1, 27 or 28", sig[64])
+	}
+	public, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("the signature doesn't recover to a public key: %w", err)
+	}
+	return crypto.PubkeyToAddress(*public), nil
+}
+
+// signingInputs are the flags of the commands that sign for a wallet, either
+// with the user share and the backup share or with an exported private key.
+type signingInputs struct {
+	userShare, backupShare, key shareInput
+	overrides                   walletOverrides
+	child                       childPath
+}
+
+func (in *signingInputs) register(fs *flag.FlagSet) {
+	in.userShare.register(fs, "user-share", "user share")
+	in.backupShare.register(fs, "backup-share", "Capsule backup share")
+	in.key.register(fs, "key", "exported private key")
+	in.overrides.register(fs)
+	in.child.register(fs)
+}
+
+// inputs lists the secret inputs, for checkStdin.
+func (in *signingInputs) inputs() []*shareInput {
+	return []*shareInput{&in.userShare, &in.backupShare, &in.key}
+}
+
+// load returns the signer the flags select. Without a private key, the
+// shares are loaded and prompted for like export does.
+func (in *signingInputs) load() (hashSigner, error) {
+	if !in.key.isSet() {
+		pair, err := loadWalletPair(&in.userShare, &in.backupShare, &in.overrides)
+		if err != nil {
+			return nil, err
+		}
+		return pair.deriveChild(in.child.steps)
+	}
+	if in.userShare.isSet() || in.backupShare.isSet() {
+		return nil, usageErrorf("sign either with the shares or with an exported private key, not both")
+	}
+	if in.child.steps != nil {
+		return nil, usageErrorf("-child needs the shares, an exported private key has no chain key to derive with")
+	}
+	data, err := in.key.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	return parsePrivateKey(string(data))
+}
+
+// parsePrivateKey parses a hex private key as printed by export.
+func parsePrivateKey(s string) (*keySigner, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "private key hex:")
+	b, err := decodeHex(s)
+	if err != nil || len(b) != 32 {
+		return nil, errors.New("the exported private key must be 32 bytes of hex")
+	}
+	key, err := crypto.ToECDSA(b)
+	if err != nil {
+		return nil, fmt.Errorf("the exported private key is not a valid secp256k1 key: %w", err)
+	}
+	return &keySigner{key: key}, nil
+}
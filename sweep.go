@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Gas limits of the sweep transactions unless they're given.
+const (
+	defaultSweepGas = 21000
+	defaultTokenGas = 100000
+)
+
+var sweepCommand = &command{
+	name:    "sweep",
+	summary: "Build and sign transactions that move everything out of the wallet, without network access.\n\nThe ether sweep is an EIP-1559 transfer of the whole balance less the most the fees of all the transactions can come to. For every -token, an ERC-20 transfer of its balance is signed too. The token transfers take the nonces from -nonce on and the ether sweep the nonce after them, so their fees are paid before the rest of the balance leaves. The transactions are shown and only signed once confirmed.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var signing signingInputs
+		var to, balance, maxFee, maxPriorityFee string
+		var chainID, nonce, gasLimit, tokenGasLimit uint64
+		var tokens tokenBalances
+		var yes bool
+		signing.register(fs)
+		fs.StringVar(&to, "to", "", "sweep to the `address`")
+		fs.Uint64Var(&chainID, "chain-id", 0, "sign for chain `id`")
+		fs.Uint64Var(&nonce, "nonce", 0, "the wallet's next `nonce`")
+		fs.StringVar(&balance, "balance", "", "the wallet's ether balance, an `amount` in wei or with a gwei or ether suffix")
+		fs.StringVar(&maxFee, "max-fee", "", "the max fee per gas, an `amount` in wei or with a gwei or ether suffix")
+		fs.StringVar(&maxPriorityFee, "max-priority-fee", "", "the max priority fee per gas, an `amount` in wei or with a gwei or ether suffix")
+		fs.Uint64Var(&gasLimit, "gas-limit", defaultSweepGas, "the gas `limit` of the ether sweep")
+		fs.Var(&tokens, "token", "also sweep `token:amount`, an ERC-20 contract and its balance in the token's smallest unit (repeatable)")
+		fs.Uint64Var(&tokenGasLimit, "token-gas-limit", defaultTokenGas, "the gas `limit` of each token transfer")
+		fs.BoolVar(&yes, "yes", false, "sign without asking for confirmation after the transactions are shown")
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -user-share-* and -backup-share-* flags")
+			}
+			for _, name := range []string{"to", "chain-id", "nonce", "balance", "max-fee", "max-priority-fee"} {
+				if !isFlagSet(fs, name) {
+					return usageErrorf("-%s is required", name)
+				}
+			}
+			if err := checkStdin(signing.inputs()...); err != nil {
+				return err
+			}
+
+			dest, err := parseAddress(to)
+			if err != nil {
+				return usageErrorf("-to: %v", err)
+			}
+			if chainID == 0 {
+				return usageErrorf("-chain-id must not be 0")
+			}
+			amounts := map[string]*big.Int{}
+			for name, value := range map[string]string{"balance": balance, "max-fee": maxFee, "max-priority-fee": maxPriorityFee} {
+				if amounts[name], err = parseWei(value); err != nil {
+					return usageErrorf("-%s: %v", name, err)
+				}
+			}
+			txs, err := sweepTxs(sweepParams{
+				to:             dest,
+				chainID:        new(big.Int).SetUint64(chainID),
+				nonce:          nonce,
+				balance:        amounts["balance"],
+				maxFee:         amounts["max-fee"],
+				maxPriorityFee: amounts["max-priority-fee"],
+				gasLimit:       gasLimit,
+				tokens:         tokens,
+				tokenGasLimit:  tokenGasLimit,
+			})
+			if err != nil {
+				return err
+			}
+
+			signer := types.LatestSignerForChainID(new(big.Int).SetUint64(chainID))
+			for i, tx := range txs {
+				fmt.Fprintf(os.Stderr, "\n%d of %d: ", i+1, len(txs))
+				previewTx(os.Stderr, tx, signer)
+			}
+			if !yes {
+				question := fmt.Sprintf("Sign these %d transactions?", len(txs))
+				if len(txs) == 1 {
+					question = "Sign this transaction?"
+				}
+				if err := confirmOnTerminal(question, "nothing was signed"); err != nil {
+					return err
+				}
+			}
+
+			s, err := signing.load()
+			if err != nil {
+				return err
+			}
+			signed := make([]*types.Transaction, len(txs))
+			for i, tx := range txs {
+				if signed[i], err = signTx(tx, signer, s); err != nil {
+					return fmt.Errorf("signing transaction %d: %w", i+1, err)
+				}
+			}
+			for i, tx := range signed {
+				fmt.Printf("\ntransaction %d of %d, nonce %d\n", i+1, len(signed), tx.Nonce())
+				if err := printSignedTx(tx); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	},
+}
+
+// sweepParams are the inputs of a sweep, all of them given offline.
+type sweepParams struct {
+	to                     common.Address
+	chainID                *big.Int
+	nonce                  uint64
+	balance                *big.Int
+	maxFee, maxPriorityFee *big.Int
+	gasLimit               uint64
+	tokens                 tokenBalances
+	tokenGasLimit          uint64
+}
+
+// sweepTxs builds the unsigned token transfers and the ether sweep, which
+// sends what is left of the balance once every transaction paid its max fee.
+func sweepTxs(p sweepParams) ([]*types.Transaction, error) {
+	if p.maxPriorityFee.Cmp(p.maxFee) > 0 {
+		return nil, errors.New("the max priority fee is higher than the max fee")
+	}
+	if p.gasLimit < defaultSweepGas {
+		return nil, fmt.Errorf("the gas limit of the ether sweep is below %d", defaultSweepGas)
+	}
+
+	var txs []*types.Transaction
+	fees := new(big.Int)
+	newTx := func(to common.Address, value *big.Int, gas uint64, data []byte) {
+		txs = append(txs, types.NewTx(&types.DynamicFeeTx{
+			ChainID:   p.chainID,
+			Nonce:     p.nonce + uint64(len(txs)),
+			GasTipCap: p.maxPriorityFee,
+			GasFeeCap: p.maxFee,
+			Gas:       gas,
+			To:        &to,
+			Value:     value,
+			Data:      data,
+		}))
+		fees.Add(fees, new(big.Int).Mul(new(big.Int).SetUint64(gas), p.maxFee))
+	}
+	for _, token := range p.tokens {
+		newTx(token.contract, new(big.Int), p.tokenGasLimit, encodeTransfer(p.to, token.amount))
+	}
+
+	fees.Add(fees, new(big.Int).Mul(new(big.Int).SetUint64(p.gasLimit), p.maxFee))
+	value := new(big.Int).Sub(p.balance, fees)
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("the balance of %s ether doesn't cover the max fees of %s ether", formatUnits(p.balance, 18), formatUnits(fees, 18))
+	}
+	newTx(p.to, value, p.gasLimit, nil)
+	return txs, nil
+}
+
+// encodeTransfer encodes the calldata of an ERC-20 transfer.
+func encodeTransfer(to common.Address, amount *big.Int) []byte {
+	data := crypto.Keccak256([]byte("transfer(address,uint256)"))[:4]
+	data = append(data, common.LeftPadBytes(to.Bytes(), 32)...)
+	return append(data, common.LeftPadBytes(amount.Bytes(), 32)...)
+}
+
+// tokenBalance is an ERC-20 token to sweep.
+type tokenBalance struct {
+	contract common.Address
+	amount   *big.Int
+}
+
+// tokenBalances is a repeatable token:amount flag.
+type tokenBalances []tokenBalance
+
+func (t *tokenBalances) String() string {
+	parts := make([]string, len(*t))
+	for i, token := range *t {
+		parts[i] = token.contract.Hex() + ":" + token.amount.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (t *tokenBalances) Set(s string) error {
+	contract, amount, ok := strings.Cut(s, ":")
+	if !ok {
+		return errors.New("expected token:amount")
+	}
+	address, err := parseAddress(contract)
+	if err != nil {
+		return err
+	}
+	n, ok := new(big.Int).SetString(amount, 10)
+	if !ok || n.Sign() <= 0 || n.BitLen() > 256 {
+		return fmt.Errorf("invalid token amount %q", amount)
+	}
+	*t = append(*t, tokenBalance{contract: address, amount: n})
+	return nil
+}
+
+// parseAddress parses a hex address, checking its EIP-55 checksum when it
+// has one.
+func parseAddress(s string) (common.Address, error) {
+	if !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("%q is not an address", s)
+	}
+	address := common.HexToAddress(s)
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && "0x"+digits != address.Hex() {
+		return common.Address{}, fmt.Errorf("%s has an invalid checksum", s)
+	}
+	if address == (common.Address{}) {
+		return common.Address{}, errors.New("the zero address can't be used")
+	}
+	return address, nil
+}
+
+// weiUnits are the unit suffixes amounts of ether can be given with.
+var weiUnits = []struct {
+	suffix   string
+	decimals int
+}{
+	{"gwei", 9},
+	{"ether", 18},
+	{"eth", 18},
+	{"wei", 0},
+}
+
+// parseWei parses an amount in wei, or a decimal amount with a gwei or ether
+// suffix.
+func parseWei(s string) (*big.Int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	decimals := 0
+	for _, unit := range weiUnits {
+		if number, ok := strings.CutSuffix(s, unit.suffix); ok {
+			s, decimals = strings.TrimSpace(number), unit.decimals
+			break
+		}
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > decimals {
+		return nil, fmt.Errorf("%q has more than %d decimals, which is finer than a wei", s, decimals)
+	}
+	digits := whole + frac + strings.Repeat("0", decimals-len(frac))
+	n, ok := new(big.Int).SetString(digits, 10)
+	if !ok || whole == "" || strings.ContainsAny(digits, "+-") {
+		return nil, fmt.Errorf("%q is not an amount", s)
+	}
+	return n, nil
+}
+
+// isFlagSet reports whether a flag was given on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
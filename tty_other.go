@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoTerminal = errors.New("interactive prompts are not supported on this platform, pass the shares with the -*-file or -*-fd flags")
+
+func openTerminal() (*os.File, error) {
+	return nil, errNoTerminal
+}
+
+func disableEcho(tty *os.File) (func(), error) {
+	return nil, errNoTerminal
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openTerminal opens the controlling terminal, independently of any
+// redirection of stdin and stdout.
+func openTerminal() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+// disableEcho switches the terminal to non-canonical mode with echo turned
+// off and returns a function restoring the previous state.
+//
+// Canonical mode is turned off as well because the kernel truncates
+// canonical lines at MAX_CANON bytes, which is shorter than a serialized share.
+func disableEcho(tty *os.File) (func(), error) {
+	fd := int(tty.Fd())
+	old, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	t := *old
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON
+	t.Lflag |= unix.ISIG
+	t.Iflag |= unix.ICRNL
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, &t); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		_ = unix.IoctlSetTermios(fd, ioctlWriteTermios, old)
+	}, nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var signTxCommand = &command{
+	name:    "sign-tx",
+	summary: "Sign a raw unsigned Ethereum transaction offline.\n\nThe transaction is given as the hex of its RLP encoding, with or without zero signature fields: a legacy transaction, with EIP-155 replay protection when it records a chain ID or -chain-id is given, or an EIP-2930, EIP-1559 or EIP-4844 typed transaction. Blob transactions may carry their blob sidecar, which is checked against the blob hashes. It's signed with the user share and the Capsule backup share in-process, or with an exported private key. The decoded transaction is shown first, with calls to common token and multicall functions decoded, and it's only signed once confirmed. The signed transaction is printed ready to broadcast from another machine.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var signing signingInputs
+		var txInput shareInput
+		var txHex string
+		var chainID uint64
+		var yes bool
+		signing.register(fs)
+		txInput.register(fs, "tx", "unsigned transaction")
+		fs.StringVar(&txHex, "tx", "", "sign the unsigned transaction given as `hex`")
+		fs.Uint64Var(&chainID, "chain-id", 0, "sign a legacy transaction for chain `id` with EIP-155 replay protection")
+		fs.BoolVar(&yes, "yes", false, "sign without asking for confirmation after the transaction is shown")
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -user-share-* and -backup-share-* flags")
+			}
+			if err := checkStdin(append(signing.inputs(), &txInput)...); err != nil {
+				return err
+			}
+			raw, err := readTxInput(txHex, &txInput)
+			if err != nil {
+				return err
+			}
+			var chain *big.Int
+			if chainID != 0 {
+				chain = new(big.Int).SetUint64(chainID)
+			}
+			tx, signer, err := parseUnsignedTx(raw, chain)
+			if err != nil {
+				return err
+			}
+			previewTx(os.Stderr, tx, signer)
+			if !yes {
+				if err := confirmOnTerminal("Sign this transaction?", "the transaction was not signed"); err != nil {
+					return err
+				}
+			}
+
+			s, err := signing.load()
+			if err != nil {
+				return err
+			}
+			signed, err := signTx(tx, signer, s)
+			if err != nil {
+				return err
+			}
+			return printSignedTx(signed)
+		}
+	},
+}
+
+// readTxInput returns the raw transaction given either as hex on the command
+// line or through its input flags.
+func readTxInput(txHex string, in *shareInput) ([]byte, error) {
+	if txHex != "" && in.isSet() {
+		return nil, usageErrorf("give the transaction either with -tx or with -tx-file/-tx-fd")
+	}
+	if txHex == "" {
+		if !in.isSet() {
+			return nil, usageErrorf("no transaction given, use -tx, -tx-file or -tx-fd")
+		}
+		data, err := in.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		txHex = string(data)
+	}
+	raw, err := decodeHex(txHex)
+	if err != nil {
+		return nil, fmt.Errorf("the transaction is not valid hex: %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, errors.New("the transaction is empty")
+	}
+	return raw, nil
+}
+
+// unsignedFields is the number of fields of each transaction type without
+// the signature values v, r and s.
+var unsignedFields = map[byte]int{
+	types.LegacyTxType:     6,
+	types.AccessListTxType: 8,
+	types.DynamicFeeTxType: 9,
+	types.BlobTxType:       11,
+}
+
+// txTypeNames names the transaction types for display.
+var txTypeNames = map[byte]string{
+	types.LegacyTxType:     "legacy",
+	types.AccessListTxType: "EIP-2930",
+	types.DynamicFeeTxType: "EIP-1559",
+	types.BlobTxType:       "EIP-4844",
+}
+
+// parseUnsignedTx decodes a raw unsigned transaction and picks the signer that
+// hashes it. Legacy transactions are replay protected when they record a
+// chain ID, as v with zero r and s, or when chainID is given.
+func parseUnsignedTx(raw []byte, chainID *big.Int) (*types.Transaction, types.Signer, error) {
+	txType := byte(types.LegacyTxType)
+	body := raw
+	if raw[0] <= 0x7f {
+		txType, body = raw[0], raw[1:]
+	}
+	if _, ok := unsignedFields[txType]; !ok {
+		return nil, nil, fmt.Errorf("transaction type 0x%02x is not supported", txType)
+	}
+
+	body, err := withSignatureFields(txType, body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("the %s transaction doesn't decode: %w", txTypeNames[txType], err)
+	}
+	if txType != types.LegacyTxType {
+		body = append([]byte{txType}, body...)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(body); err != nil {
+		return nil, nil, fmt.Errorf("the %s transaction doesn't decode: %w", txTypeNames[txType], err)
+	}
+
+	v, r, s := tx.RawSignatureValues()
+	if r.Sign() != 0 || s.Sign() != 0 {
+		return nil, nil, errors.New("the transaction is already signed")
+	}
+
+	if txType != types.LegacyTxType {
+		if chainID != nil && chainID.Cmp(tx.ChainId()) != 0 {
+			return nil, nil, fmt.Errorf("the transaction is for chain %s, not %s", tx.ChainId(), chainID)
+		}
+		if err := checkSidecar(tx); err != nil {
+			return nil, nil, err
+		}
+		return tx, types.LatestSignerForChainID(tx.ChainId()), nil
+	}
+
+	// An unsigned EIP-155 transaction records its chain ID in v.
+	switch {
+	case chainID == nil:
+		chainID = v
+	case v.Sign() != 0 && v.Cmp(chainID) != 0:
+		return nil, nil, fmt.Errorf("the transaction is for chain %s, not %s", v, chainID)
+	}
+	tx = types.NewTx(&types.LegacyTx{
+		Nonce:    tx.Nonce(),
+		GasPrice: tx.GasPrice(),
+		Gas:      tx.Gas(),
+		To:       tx.To(),
+		Value:    tx.Value(),
+		Data:     tx.Data(),
+	})
+	if chainID.Sign() == 0 {
+		fmt.Fprintln(os.Stderr, "warning: the legacy transaction has no chain ID and is signed without EIP-155 replay protection")
+		return tx, types.HomesteadSigner{}, nil
+	}
+	return tx, types.NewEIP155Signer(chainID), nil
+}
+
+// withSignatureFields appends zero signature values to the rlp list of an
+// unsigned transaction so that it decodes as a transaction. Lists that
+// already have them are returned as they are. A blob transaction in its
+// network form wraps the transaction in a list with the blob sidecar.
+func withSignatureFields(txType byte, body []byte) ([]byte, error) {
+	var fields []rlp.RawValue
+	if err := rlp.DecodeBytes(body, &fields); err != nil {
+		return nil, err
+	}
+	if txType == types.BlobTxType && len(fields) == 4 {
+		if kind, _, _, err := rlp.Split(fields[0]); err == nil && kind == rlp.List {
+			inner, err := withSignatureFields(txType, fields[0])
+			if err != nil {
+				return nil, err
+			}
+			fields[0] = inner
+			return rlp.EncodeToBytes(fields)
+		}
+	}
+
+	n := unsignedFields[txType]
+	switch len(fields) {
+	case n + 3:
+		return body, nil
+	case n:
+		for i := 0; i < 3; i++ {
+			fields = append(fields, rlp.RawValue{rlp.EmptyString[0]})
+		}
+		return rlp.EncodeToBytes(fields)
+	}
+	return nil, fmt.Errorf("it has %d fields instead of %d, or %d with the signature", len(fields), n, n+3)
+}
+
+// checkSidecar checks that the blobs a blob transaction carries match its
+// blob hashes.
+func checkSidecar(tx *types.Transaction) error {
+	if tx.Type() != types.BlobTxType {
+		return nil
+	}
+	sidecar := tx.BlobTxSidecar()
+	if sidecar == nil {
+		fmt.Fprintln(os.Stderr, "warning: the blob transaction carries no sidecar, the blobs have to be attached before it can be broadcast")
+		return nil
+	}
+	if len(sidecar.Blobs) != len(sidecar.Commitments) || len(sidecar.Blobs) != len(sidecar.Proofs) {
+		return fmt.Errorf("the blob sidecar has %d blobs, %d commitments and %d proofs", len(sidecar.Blobs), len(sidecar.Commitments), len(sidecar.Proofs))
+	}
+	hashes := tx.BlobHashes()
+	if len(hashes) != len(sidecar.Blobs) {
+		return fmt.Errorf("the transaction has %d blob hashes but its sidecar %d blobs", len(hashes), len(sidecar.Blobs))
+	}
+	for i, h := range sidecar.BlobHashes() {
+		if h != hashes[i] {
+			return fmt.Errorf("blob %d of the sidecar doesn't match blob hash %s", i, hashes[i].Hex())
+		}
+		if err := kzg4844.VerifyBlobProof(&sidecar.Blobs[i], sidecar.Commitments[i], sidecar.Proofs[i]); err != nil {
+			return fmt.Errorf("the kzg proof of blob %d doesn't verify: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// signTx signs a transaction and checks that the signed transaction is sent
+// from the signer's address.
+func signTx(tx *types.Transaction, signer types.Signer, s hashSigner) (*types.Transaction, error) {
+	hash := signer.Hash(tx)
+	sig, err := s.signHash(hash[:])
+	if err != nil {
+		return nil, err
+	}
+	signed, err := tx.WithSignature(signer, sig)
+	if err != nil {
+		return nil, err
+	}
+	want, err := s.address()
+	if err != nil {
+		return nil, err
+	}
+	from, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, fmt.Errorf("the signed transaction has no valid sender: %w", err)
+	}
+	if from != want {
+		return nil, fmt.Errorf("the signed transaction is sent from %s instead of the wallet's address %s", from.Hex(), want.Hex())
+	}
+	return signed, nil
+}
+
+func printSignedTx(tx *types.Transaction) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	// round trip the encoding, so what is printed is what a node will decode
+	var decoded types.Transaction
+	if err := decoded.UnmarshalBinary(raw); err != nil || decoded.Hash() != tx.Hash() {
+		return errors.New("the signed transaction doesn't decode back to itself")
+	}
+
+	fmt.Printf("type: %s (0x%02x)\n", txTypeNames[tx.Type()], tx.Type())
+	fmt.Println("signed transaction hex:")
+	fmt.Println("0x" + hex.EncodeToString(raw))
+	fmt.Println("transaction hash:")
+	fmt.Println(tx.Hash().Hex())
+	return nil
+}
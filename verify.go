@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	mpcsigner "github.com/capsule-org/go-sdk/signer"
+	"github.com/capsule-org/multi-party-sig/pkg/math/curve"
+)
+
+// keyCheckError reports which check a reconstructed private key failed.
+type keyCheckError struct {
+	check  string
+	detail string
+}
+
+func (e *keyCheckError) Error() string {
+	return fmt.Sprintf("refusing to print the private key, the %s check failed: %s", e.check, e.detail)
+}
+
+// reconstructKey adds up the secret shares of the two halves of a wallet,
+// and only returns the key once both configs agree on the wallet and the key
+// is the one behind their public key. backupWalletId is the wallet ID the
+// backup share records, if it records one.
+func reconstructKey(user, backup *mpcsigner.DKLSSigner, backupWalletId string) (curve.Scalar, error) {
+	if backupWalletId != "" && backupWalletId != user.GetWalletId() {
+		return nil, &keyCheckError{"wallet ID", fmt.Sprintf("the user share belongs to wallet %s, the backup share to wallet %s", user.GetWalletId(), backupWalletId)}
+	}
+
+	userKey, err := signerShare(user)
+	if err != nil {
+		return nil, &keyCheckError{"user share", err.Error()}
+	}
+	backupKey, err := signerShare(backup)
+	if err != nil {
+		return nil, &keyCheckError{"backup share", err.Error()}
+	}
+	if userKey.isReceiver == backupKey.isReceiver {
+		return nil, &keyCheckError{"role", fmt.Sprintf("both shares are %ss", roleName(userKey.isReceiver))}
+	}
+
+	if !userKey.public.Equal(backupKey.public) {
+		return nil, &keyCheckError{"public key", "the user share and the backup share record different public keys, they belong to different wallets"}
+	}
+	if userKey.refreshedApart(backupKey) {
+		return nil, &keyCheckError{"refresh generation", errRefreshGeneration.Error()}
+	}
+	if !bytes.Equal(userKey.chainKey, backupKey.chainKey) {
+		return nil, &keyCheckError{"chain key", "the user share and the backup share record different chain keys"}
+	}
+
+	if userKey.secretShare.IsZero() {
+		return nil, &keyCheckError{"secret share", "the user share's secret share is zero"}
+	}
+	if backupKey.secretShare.IsZero() {
+		return nil, &keyCheckError{"secret share", "the backup share's secret share is zero"}
+	}
+
+	// shares at or above the curve order are already refused when their
+	// configs are decoded, and the sum is reduced, so only zero is left
+	sk := curve.Secp256k1{}.NewScalar().Set(userKey.secretShare).Add(backupKey.secretShare)
+	if sk.IsZero() {
+		return nil, &keyCheckError{"private key range", "the secret shares add up to zero"}
+	}
+
+	public := sk.ActOnBase()
+	if !public.Equal(userKey.public) {
+		return nil, &keyCheckError{"public key", "the reconstructed key doesn't match the public key of the user share"}
+	}
+	if !public.Equal(backupKey.public) {
+		return nil, &keyCheckError{"public key", "the reconstructed key doesn't match the public key of the backup share"}
+	}
+	return sk, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+var verifyPairCommand = &command{
+	name:    "verify-pair",
+	summary: "Check that a Capsule backup share still belongs with a user share, without reconstructing the private key.\n\nOnly the public points of the two secret shares are computed and compared with the wallet's public key, so the secrets are never combined.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var userShare, backupShare shareInput
+		var overrides walletOverrides
+		userShare.register(fs, "user-share", "user share")
+		backupShare.register(fs, "backup-share", "Capsule backup share")
+		overrides.register(fs)
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -user-share-* and -backup-share-* flags")
+			}
+			if err := checkStdin(&userShare, &backupShare); err != nil {
+				return err
+			}
+			return runVerifyPair(&userShare, &backupShare, &overrides)
+		}
+	},
+}
+
+// runVerifyPair prints whether the two shares make up one wallet.
+func runVerifyPair(userShare, backupShare *shareInput, overrides *walletOverrides) error {
+	user, err := loadUserShare(userShare)
+	if err != nil {
+		return err
+	}
+	if err := overrides.apply(user); err != nil {
+		return err
+	}
+	userSigner, err := user.dklsUserSigner()
+	if err != nil {
+		return err
+	}
+	userKey, err := signerShare(userSigner)
+	if err != nil {
+		return err
+	}
+	address, err := userSigner.GetAddress()
+	if err != nil {
+		return err
+	}
+
+	backup, err := loadBackupShare(backupShare)
+	if err != nil {
+		return err
+	}
+	config, err := backup.backupConfig(userKey.isReceiver)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("wallet ID: %s\n", userSigner.GetWalletId())
+	fmt.Printf("address:   %s\n", address)
+
+	err = checkPair(userSigner.GetWalletId(), userKey, config, overrides.backupWalletId(backup))
+	if err != nil {
+		fmt.Printf("FAIL: %v\n", err)
+		return errors.New("the backup share doesn't belong with the user share")
+	}
+	fmt.Println("PASS: the backup share belongs with the user share")
+	return nil
+}
+
+// checkPair checks a backup config against the user's share by their public
+// points alone, repairing characters mangled by the pdf first.
+func checkPair(walletId string, userKey *dklsShare, config, backupWalletId string) error {
+	if backupWalletId != "" && backupWalletId != walletId {
+		return fmt.Errorf("the backup share belongs to wallet %s", backupWalletId)
+	}
+
+	config, fixes, err := repairBackupKey(config, userKey)
+	if err != nil {
+		return err
+	}
+	for _, fix := range fixes {
+		fmt.Fprintf(os.Stderr, "repaired backup key at %s\n", fix)
+	}
+
+	backupKey, err := decodeShareConfig(config, !userKey.isReceiver)
+	if err != nil {
+		return fmt.Errorf("the backup key doesn't decode to a %s config: %w", roleName(!userKey.isReceiver), err)
+	}
+	return userKey.pairs(backupKey)
+}
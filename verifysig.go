@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var verifyCommand = &command{
+	name:    "verify",
+	summary: "Recover the signer of a signature and check that it's the wallet of a share.\n\nThe signature can be of a personal_sign message (EIP-191), of EIP-712 typed data or of a raw 32-byte hash, or be part of a signed transaction. Only public data is needed: the share is optional and is used for its address alone, so the user share or a backup key is enough.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var share, typedInput, txInput shareInput
+		var msg messageInput
+		var sigHex, hashHex, txHex string
+		share.register(fs, "share", "share")
+		fs.StringVar(&sigHex, "signature", "", "verify the 65-byte signature given as `hex`")
+		msg.register(fs)
+		typedInput.register(fs, "typed-data", "EIP-712 typed data")
+		fs.StringVar(&hashHex, "hash", "", "verify a signature of the 32-byte `hex` hash")
+		txInput.register(fs, "tx", "signed transaction")
+		fs.StringVar(&txHex, "tx", "", "verify the signed transaction given as `hex`")
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -share-* flags")
+			}
+			given := msg.given()
+			for _, set := range []bool{typedInput.isSet(), hashHex != "", txHex != "" || txInput.isSet()} {
+				if set {
+					given++
+				}
+			}
+			if given != 1 {
+				return usageErrorf("give exactly one of a message, typed data, a hash or a signed transaction")
+			}
+			isTx := txHex != "" || txInput.isSet()
+			switch {
+			case isTx && sigHex != "":
+				return usageErrorf("a signed transaction carries its own signature, leave out -signature")
+			case !isTx && sigHex == "":
+				return usageErrorf("no signature given, use -signature")
+			}
+			if err := checkStdin(&share, &msg.file, &typedInput, &txInput); err != nil {
+				return err
+			}
+
+			var signer common.Address
+			if isTx {
+				raw, err := readTxInput(txHex, &txInput)
+				if err != nil {
+					return err
+				}
+				if signer, err = recoverTxSender(raw); err != nil {
+					return err
+				}
+			} else {
+				sig, err := decodeHex(sigHex)
+				if err != nil || len(sig) != 65 {
+					return usageErrorf("-signature must be 65 bytes of hex")
+				}
+				digest, err := verifyDigest(&msg, &typedInput, hashHex)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("digest:  0x%x\n", digest)
+				if signer, err = recoverSigner(digest, sig); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("signer:  %s\n", signer.Hex())
+
+			if !share.isSet() {
+				return nil
+			}
+			data, err := share.readBytes()
+			if err != nil {
+				return err
+			}
+			loaded, err := classifyShare(data, true)
+			if err != nil {
+				return err
+			}
+			address, err := shareAddress(loaded)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("wallet:  %s\n", address.Hex())
+			if signer != address {
+				fmt.Println("FAIL: the signature was not made by the wallet of the share")
+				return errors.New("the signer is not the wallet of the share")
+			}
+			fmt.Println("PASS: the signature was made by the wallet of the share")
+			return nil
+		}
+	},
+}
+
+// verifyDigest computes the digest a signature is checked against.
+func verifyDigest(msg *messageInput, typedInput *shareInput, hashHex string) ([]byte, error) {
+	switch {
+	case hashHex != "":
+		hash, err := decodeHex(hashHex)
+		if err != nil || len(hash) != 32 {
+			return nil, usageErrorf("-hash must be 32 bytes of hex")
+		}
+		return hash, nil
+	case typedInput.isSet():
+		data, err := typedInput.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		td, err := parseTypedData(data)
+		if err != nil {
+			return nil, err
+		}
+		_, _, digest, err := td.hashes()
+		return digest, err
+	}
+	message, err := msg.read()
+	if err != nil {
+		return nil, err
+	}
+	return personalMessageHash(message), nil
+}
+
+// recoverTxSender decodes a signed transaction and returns its sender.
+func recoverTxSender(raw []byte) (common.Address, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return common.Address{}, fmt.Errorf("the signed transaction doesn't decode: %w", err)
+	}
+	var signer types.Signer = types.HomesteadSigner{}
+	if tx.Protected() {
+		signer = types.LatestSignerForChainID(tx.ChainId())
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("the transaction's signature doesn't recover: %w", err)
+	}
+	fmt.Printf("type:    %s (0x%02x)\n", txTypeNames[tx.Type()], tx.Type())
+	fmt.Printf("tx hash: %s\n", tx.Hash().Hex())
+	return from, nil
+}
+
+// shareAddress returns the address of the wallet a DKLS share or backup key
+// belongs to, from its public key alone.
+func shareAddress(share *loadedShare) (common.Address, error) {
+	key, err := sharePublicData(share)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return ethereumAddress(key.public)
+}
+
+// sharePublicData decodes the config of a DKLS share or backup key, of
+// which only the public key and chain key are meant to be used.
+func sharePublicData(share *loadedShare) (*dklsShare, error) {
+	switch {
+	case share.dkls != nil:
+		return signerShare(share.dkls)
+	case share.backupKey != "":
+		key, err := decodeShareConfig(share.backupKey, true)
+		if err != nil {
+			key, err = decodeShareConfig(share.backupKey, false)
+		}
+		return key, err
+	}
+	return nil, errors.New("only DKLS shares have an Ethereum address")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var xprvCommand = &command{
+	name:    "xprv",
+	summary: "Export the wallet's BIP32 root extended private key and derive child keys from it.\n\nThe root key is the reconstructed private key with the chain key both shares record, at depth 0. With -path, keys are derived along a BIP32 path such as m/44'/60'/0'/0/i, hardened steps included. A last step of i stands for -count indices from -start on. The address, private key and extended private key of every derived key are printed, so wallets that use derived accounts can be recovered.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var userShare, backupShare shareInput
+		var overrides walletOverrides
+		var pathArg string
+		var start, count uint
+		userShare.register(fs, "user-share", "user share")
+		backupShare.register(fs, "backup-share", "Capsule backup share")
+		overrides.register(fs)
+		fs.StringVar(&pathArg, "path", "", "derive the keys along the BIP32 `path`, such as m/44'/60'/0'/0/i")
+		fs.UintVar(&start, "start", 0, "the first `index` a last path step of i stands for")
+		fs.UintVar(&count, "count", 1, "the `number` of indices a last path step of i stands for")
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -user-share-* and -backup-share-* flags")
+			}
+			paths, err := derivationPaths(fs, pathArg, start, count)
+			if err != nil {
+				return err
+			}
+			if err := checkStdin(&userShare, &backupShare); err != nil {
+				return err
+			}
+
+			sk, pair, err := loadPrivateKey(&userShare, &backupShare, &overrides, nil)
+			if err != nil {
+				return err
+			}
+			root, err := newRootKey(sk, pair.userKey.public, pair.userKey.chainKey)
+			if err != nil {
+				return err
+			}
+			fmt.Println("root extended private key (depth 0):")
+			fmt.Println(root)
+			fmt.Println("root extended public key:")
+			fmt.Println(root.neuter())
+
+			for _, path := range paths {
+				key, err := root.derive(path)
+				if err != nil {
+					return fmt.Errorf("deriving %s: %w", formatPath(path), err)
+				}
+				address, err := ethereumAddress(key.public)
+				if err != nil {
+					return err
+				}
+				secret, err := key.private.MarshalBinary()
+				if err != nil {
+					return err
+				}
+				fmt.Printf("\n%s\n", formatPath(path))
+				fmt.Printf("  address:      %s\n", address.Hex())
+				fmt.Printf("  private key:  0x%x\n", secret)
+				fmt.Printf("  xprv:         %s\n", key)
+			}
+			return nil
+		}
+	},
+}
+
+// derivationPaths parses the -path, -start and -count flags into the paths
+// to derive. Without -path there are none.
+func derivationPaths(fs *flag.FlagSet, pathArg string, start, count uint) ([][]uint32, error) {
+	ranged := isFlagSet(fs, "start") || isFlagSet(fs, "count")
+	if pathArg == "" {
+		if ranged {
+			return nil, usageErrorf("-start and -count need a -path ending in i")
+		}
+		return nil, nil
+	}
+	path, err := parseDerivationPath(pathArg)
+	if err != nil {
+		return nil, usageErrorf("-path: %v", err)
+	}
+	if ranged && !path.indexed {
+		return nil, usageErrorf("-start and -count need a -path ending in i")
+	}
+	if count == 0 {
+		return nil, usageErrorf("-count must be at least 1")
+	}
+	if start >= hardenedOffset || count > hardenedOffset {
+		return nil, usageErrorf("-start and -count must be below 2^31")
+	}
+	paths, err := path.expand(uint32(start), uint32(count))
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	return paths, nil
+}
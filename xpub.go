@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// defaultWatchCount is how many addresses xpub lists unless told otherwise.
+const defaultWatchCount = 10
+
+var xpubCommand = &command{
+	name:    "xpub",
+	summary: "Print the wallet's BIP32 extended public key and a watch-only list of child addresses, from one share alone.\n\nOnly the public key and the chain key of the share are used, so the user share or a backup key is enough and nothing secret is reconstructed. Children are derived the way the DKLS shares derive them, along -path from the root key, for -count indices from -start on. Without a private key only non-hardened steps can be derived.",
+	setup: func(fs *flag.FlagSet) func(args []string) error {
+		var share shareInput
+		var pathArg string
+		var start, count uint
+		share.register(fs, "share", "share")
+		fs.StringVar(&pathArg, "path", "m/i", "derive the addresses along the non-hardened BIP32 `path`")
+		fs.UintVar(&start, "start", 0, "the first `index` a last path step of i stands for")
+		fs.UintVar(&count, "count", defaultWatchCount, "the `number` of indices a last path step of i stands for")
+
+		return func(args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("shares are not accepted as arguments, use the -share-* flags")
+			}
+			paths, err := derivationPaths(fs, pathArg, start, count)
+			if err != nil {
+				return err
+			}
+			for _, path := range paths {
+				for _, i := range path {
+					if i >= hardenedOffset {
+						return usageErrorf("-path: %s has a hardened step, which needs the private key, use xprv", formatPath(path))
+					}
+				}
+			}
+
+			data, err := share.readOrPrompt()
+			if err != nil {
+				return err
+			}
+			loaded, err := classifyShare(data, true)
+			if err != nil {
+				return err
+			}
+			key, err := sharePublicData(loaded)
+			if err != nil {
+				return err
+			}
+			root, err := newRootKey(nil, key.public, key.chainKey)
+			if err != nil {
+				return err
+			}
+			address, err := ethereumAddress(key.public)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("root extended public key (depth 0):")
+			fmt.Println(root)
+			fmt.Printf("root address: %s\n\n", address.Hex())
+			for _, path := range paths {
+				child, err := root.derive(path)
+				if err != nil {
+					return fmt.Errorf("deriving %s: %w", formatPath(path), err)
+				}
+				address, err := ethereumAddress(child.public)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%-16s %s\n", formatPath(path), address.Hex())
+			}
+			return nil
+		}
+	},
+}